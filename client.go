@@ -0,0 +1,311 @@
+package nrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// errClientStreamClosed is returned when sending to a client stream once it is ended
+var errClientStreamClosed = errors.New("nRPC client stream closed")
+
+// errClientStreamReplied is returned when sending to a client stream once the server replied to
+// the call without a stream subject, the reply is received with Recv
+var errClientStreamReplied = errors.New("nRPC client stream replied")
+
+// streamSubjectWait is the longest wait of a client stream for the StreamSubjectHeader of the
+// trigger instance serving the call, it is sent once the first request message is received
+const streamSubjectWait = time.Second
+
+// msgPublisher is a NATS connection publishing messages with headers, such as *nats.Conn
+type msgPublisher interface {
+	PublishMsg(msg *nats.Msg) error
+}
+
+// publishRequest publishes an nRPC request message with the reply subject of the call. The
+// message carries the timeout of the caller in the TimeoutHeader and the reply subject in the
+// ReplyToHeader for the triggers in durable mode, unless nc or the server do not support headers.
+func publishRequest(nc nrpc.NatsConn, subject, reply string, data []byte, timeout time.Duration) error {
+	if publisher, ok := nc.(msgPublisher); ok {
+		msg := nats.NewMsg(subject)
+		msg.Reply = reply
+		msg.Data = data
+		if reply != "" {
+			msg.Header.Set(ReplyToHeader, reply)
+		}
+		if timeout > 0 {
+			msg.Header.Set(TimeoutHeader, strconv.FormatInt(timeout.Milliseconds(), 10))
+		}
+		if err := publisher.PublishMsg(msg); err != nats.ErrHeadersNotSupported {
+			return err
+		}
+	}
+	return nc.PublishRequest(subject, reply, data)
+}
+
+// Call calls a unary nRPC method on subject and receives its reply into resp, as nrpc.Call with
+// the request headers of publishRequest. It is used by the generated clients.
+func Call(req, resp proto.Message, nc nrpc.NatsConn, subject, encoding string, timeout time.Duration) error {
+	data, err := nrpc.Marshal(encoding, req)
+	if err != nil {
+		return err
+	}
+
+	if encoding != "protobuf" {
+		subject += "." + encoding
+	}
+
+	if _, noReply := resp.(*nrpc.NoReply); noReply {
+		return publishRequest(nc, subject, "", data, timeout)
+	}
+
+	reply := nrpc.GetReplyInbox(nc)
+	sub, err := nc.SubscribeSync(reply)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	if err := publishRequest(nc, subject, reply, data, timeout); err != nil {
+		return err
+	}
+
+	msg, err := sub.NextMsg(timeout)
+	if err != nil {
+		return err
+	}
+	return nrpc.UnmarshalResponse(encoding, msg.Data, resp)
+}
+
+// StreamCall calls a server-streaming nRPC method on subject, as nrpc.StreamCall with the request
+// headers of publishRequest. It is used by the generated clients.
+func StreamCall(ctx context.Context, nc nrpc.NatsConn, subject string, req proto.Message, encoding string, timeout time.Duration) (*nrpc.StreamCallSubscription, error) {
+	data, err := nrpc.Marshal(encoding, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoding != "protobuf" {
+		subject += "." + encoding
+	}
+
+	reply := nrpc.GetReplyInbox(nc)
+	sub, err := nrpc.NewStreamCallSubscription(ctx, nc, encoding, reply, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// The subscription ends with the timeout when the request cannot be published
+	if err := publishRequest(nc, subject, reply, data, timeout); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ClientStream calls a client-streaming or bidirectional nRPC method. The request messages are
+// published with the reply subject and the headers of the call, the end of the stream is an nRPC
+// EOS error carrying the number of messages sent. The first message is published to the method
+// subject, the following ones to the StreamSubjectHeader of the trigger instance serving the call.
+// The replies are received with the nrpc streamed reply protocol. It is used by the generated
+// clients.
+type ClientStream struct {
+	nc       nrpc.NatsConn
+	subject  string
+	encoding string
+	reply    string
+	sub      *nrpc.StreamCallSubscription
+	cancel   context.CancelFunc
+	timeout  time.Duration
+	msgCount uint32
+	started  bool
+	sendDone bool
+	recvDone bool
+	mutex    sync.Mutex
+
+	// routed is closed once the first reply of the call, carrying its stream subject, is
+	// received. It is nil when the connection does not support headers.
+	routed        chan struct{}
+	routeOnce     sync.Once
+	routeSub      *nats.Subscription
+	streamSubject string
+}
+
+// NewClientStream starts a call of the method on the nRPC subject, timeout is the longest wait for
+// a reply or a keepalive of the server. Canceling ctx cancels the call.
+func NewClientStream(ctx context.Context, nc nrpc.NatsConn, subject, encoding string, timeout time.Duration) (*ClientStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	reply := nrpc.GetReplyInbox(nc)
+	sub, err := nrpc.NewStreamCallSubscription(ctx, nc, encoding, reply, timeout)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if encoding != "protobuf" {
+		subject += "." + encoding
+	}
+
+	s := &ClientStream{
+		nc:       nc,
+		subject:  subject,
+		encoding: encoding,
+		reply:    reply,
+		timeout:  timeout,
+		sub:      sub,
+		cancel:   cancel,
+	}
+
+	// The stream subject is sent with a keepalive, only the first reply of the call is read
+	if hc, ok := nc.(interface{ HeadersSupported() bool }); ok && hc.HeadersSupported() {
+		s.routed = make(chan struct{})
+		s.routeSub, err = nc.Subscribe(reply, func(msg *nats.Msg) {
+			streamSubject := msg.Header.Get(StreamSubjectHeader)
+			if streamSubject == "" && len(msg.Data) == 1 && msg.Data[0] == 0 {
+				return
+			}
+			_ = msg.Sub.Unsubscribe()
+			s.route(streamSubject)
+		})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// route records the stream subject of the call, empty when the call replied without it
+func (s *ClientStream) route(streamSubject string) {
+	s.routeOnce.Do(func() {
+		s.streamSubject = streamSubject
+		close(s.routed)
+	})
+}
+
+// nextSubject returns the subject of the next request message. The messages following the first
+// one are sent to the stream subject of the call, an error is returned when it is not received.
+// The method subject is kept when the connection does not support headers.
+func (s *ClientStream) nextSubject() (string, error) {
+	if !s.started || s.routed == nil {
+		s.started = true
+		return s.subject, nil
+	}
+
+	wait := streamSubjectWait
+	if s.timeout < wait {
+		wait = s.timeout
+	}
+	select {
+	case <-s.routed:
+	case <-time.After(wait):
+		s.route("")
+		_ = s.routeSub.Unsubscribe()
+		if s.streamSubject == "" {
+			return "", fmt.Errorf("No stream subject received for nRPC call on subject [%s] within %v", s.subject, wait)
+		}
+	}
+	if s.streamSubject == "" {
+		return "", errClientStreamReplied
+	}
+	return s.streamSubject, nil
+}
+
+// Send sends a request message of the call
+func (s *ClientStream) Send(msg proto.Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sendDone {
+		return errClientStreamClosed
+	}
+
+	data, err := nrpc.Marshal(s.encoding, msg)
+	if err != nil {
+		return err
+	}
+	subject, err := s.nextSubject()
+	if err != nil {
+		return err
+	}
+	if err := publishRequest(s.nc, subject, s.reply, data, s.timeout); err != nil {
+		return err
+	}
+	s.msgCount++
+	return nil
+}
+
+// CloseSend ends the stream of request messages, the replies can still be received
+func (s *ClientStream) CloseSend() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sendDone {
+		return nil
+	}
+	s.sendDone = true
+
+	data, err := nrpc.MarshalErrorResponse(s.encoding, &nrpc.Error{Type: nrpc.Error_EOS, MsgCount: s.msgCount})
+	if err != nil {
+		return err
+	}
+	subject, err := s.nextSubject()
+	if err != nil {
+		return err
+	}
+	return publishRequest(s.nc, subject, s.reply, data, s.timeout)
+}
+
+// Recv receives the next reply into msg, io.EOF is returned at the end of the replies and the
+// nRPC error replied by the server when the call failed
+func (s *ClientStream) Recv(msg proto.Message) error {
+	if s.recvDone {
+		return io.EOF
+	}
+
+	err := s.sub.Next(msg)
+	if err == nrpc.ErrEOS {
+		s.recvDone = true
+		return io.EOF
+	}
+	return err
+}
+
+// CloseAndRecv ends the stream of request messages and receives the single reply of a
+// client-streaming call into msg
+func (s *ClientStream) CloseAndRecv(msg proto.Message) error {
+	defer s.Close()
+
+	if err := s.CloseSend(); err != nil && err != errClientStreamReplied {
+		return err
+	}
+	if err := s.Recv(msg); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := s.Recv(msg.ProtoReflect().New().Interface()); err != io.EOF {
+		if err == nil {
+			return fmt.Errorf("Unexpected reply of nRPC call on subject [%s]: more than one message", s.subject)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close cancels the call, the server is notified unless the replies ended
+func (s *ClientStream) Close() {
+	s.cancel()
+	if s.routeSub != nil {
+		_ = s.routeSub.Unsubscribe()
+	}
+}
@@ -0,0 +1,406 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+const (
+	// ServerOption generates the code registering the services with the trigger
+	ServerOption = "nrpcserver"
+	// ClientOption generates typed clients calling the services over NATS
+	ClientOption = "nrpcclient"
+)
+
+var templateFuncs = template.FuncMap{
+	"goIdent":       goIdent,
+	"usedImports":   usedImports,
+	"paramArg":      paramArg,
+	"clientSubject": clientSubject,
+	"methodSubject": methodSubject,
+}
+
+var registryServerTemplate = template.Must(template.New("").Funcs(templateFuncs).Parse(`// Code generated by the flogo-nrpc-trigger build step from {{.ProtoImpPath}} at {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	nats "github.com/nats-io/nats.go"
+	{{- if .AllMethodInfo}}
+	"google.golang.org/protobuf/proto"
+	{{- end}}
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+	{{- range usedImports .GoImports .AllMethodInfo}}
+	{{.Name}} "{{.Path}}"
+	{{- end}}
+)
+{{$impl := printf "%s%s%s" .ProtoName .RegServiceName .Option | goIdent}}
+type serviceImpl{{$impl}} struct {
+	serviceInfo *flogoTrigger.ServiceInfo
+}
+
+var serviceInfo{{$impl}} = &flogoTrigger.ServiceInfo{
+	ProtoName:      {{printf "%q" .ProtoName}},
+	ServiceName:    {{printf "%q" .RegServiceName}},
+	PackageSubject: {{printf "%q" .PackageSubject}},
+	ServiceSubject: {{printf "%q" .ServiceSubject}},
+	{{- if .PackageParams}}
+	PackageParams: {{printf "%#v" .PackageParams}},
+	{{- end}}
+	{{- if .ServiceParams}}
+	ServiceParams: {{printf "%#v" .ServiceParams}},
+	{{- end}}
+}
+
+func init() {
+	flogoTrigger.ServiceRegistery.RegisterServerService(&serviceImpl{{$impl}}{
+		serviceInfo: serviceInfo{{$impl}},
+	})
+}
+
+// ServiceInfo returns the names of the service and of its proto
+func (s *serviceImpl{{$impl}}) ServiceInfo() *flogoTrigger.ServiceInfo {
+	return s.serviceInfo
+}
+
+// RunRegisterServerService serves the {{.RegServiceName}} methods with the trigger handlers
+func (s *serviceImpl{{$impl}}) RunRegisterServerService(nc *nats.Conn, trigger *flogoTrigger.Trigger, handler *flogoTrigger.Handler) error {
+	return handler.Serve(trigger, s.serviceInfo,
+		{{- range .AllMethodInfo}}{{template "method" .}}{{end}}
+	)
+}
+{{- define "method"}}
+		flogoTrigger.Method{
+			Name:       {{printf "%q" .MethodName}},
+			Subject:    {{printf "%q" .MethodSubject}},
+			NewRequest: func() proto.Message { return &{{.MethodReqName}}{} },
+			NewReply:   func() proto.Message { return &{{.MethodResName}}{} },
+			{{- if .SubjectParams}}
+			SubjectParams: {{printf "%#v" .SubjectParams}},
+			{{- end}}
+			{{- if .ServerStream}}
+			ServerStream: true,
+			{{- end}}
+			{{- if .ClientStream}}
+			ClientStream: true,
+			{{- end}}
+		},
+{{- end}}
+`))
+
+var registryClientTemplate = template.Must(template.New("").Funcs(templateFuncs).Parse(`// Code generated by the flogo-nrpc-trigger build step from {{.ProtoImpPath}} at {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	{{- if .Stream}}
+	"context"
+	{{- end}}
+	"time"
+
+	nrpc "github.com/nats-rpc/nrpc"
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+	{{- range usedImports .GoImports .AllMethodInfo}}
+	{{- if ne .Name "nrpc"}}
+	{{.Name}} "{{.Path}}"
+	{{- end}}
+	{{- end}}
+)
+{{$client := printf "%sClient" .ClientName | goIdent}}
+// {{$client}} calls the methods of the {{.RegServiceName}} nRPC service
+type {{$client}} struct {
+	nc       nrpc.NatsConn
+	Subject  string
+	Encoding string
+	Timeout  time.Duration
+}
+
+// New{{$client}} returns a client calling the {{.RegServiceName}} nRPC service over the nc NATS connection
+{{- if or .PackageParams .ServiceParams}}
+// with the values of the nRPC subject parameters of the service
+{{- end}}
+func New{{$client}}(nc nrpc.NatsConn{{range .PackageParams}}, {{paramArg "pkgParam" .}} string{{end}}{{range .ServiceParams}}, {{paramArg "svcParam" .}} string{{end}}) *{{$client}} {
+	return &{{$client}}{
+		nc:       nc,
+		Subject:  {{clientSubject .}},
+		Encoding: "protobuf",
+		Timeout:  5 * time.Second,
+	}
+}
+
+// WithSubjectPrefix prepends the subjectPrefix setting of the trigger serving the service to the
+// client subject and returns the client
+func (c *{{$client}}) WithSubjectPrefix(prefix string) *{{$client}} {
+	c.Subject = flogoTrigger.PrefixSubject(prefix, c.Subject)
+	return c
+}
+{{- range .UnaryMethodInfo}}
+
+// {{.MethodName}} calls the {{.MethodName}} method and returns its reply
+func (c *{{$client}}) {{.MethodName}}({{template "params" .}}req *{{.MethodReqName}}) (*{{.MethodResName}}, error) {
+	resp := &{{.MethodResName}}{}
+	if err := flogoTrigger.Call(req, resp, c.nc, {{methodSubject .}}, c.Encoding, c.Timeout); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+{{- end}}
+{{- range .ServerStreamMethodInfo}}
+
+// {{.MethodName}} calls the {{.MethodName}} method, cb is called with each streamed reply until the
+// end of the stream. Canceling ctx cancels the call.
+func (c *{{$client}}) {{.MethodName}}(ctx context.Context, {{template "params" .}}req *{{.MethodReqName}}, cb func(context.Context, *{{.MethodResName}})) error {
+	sub, err := flogoTrigger.StreamCall(ctx, c.nc, {{methodSubject .}}, req, c.Encoding, c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp := &{{.MethodResName}}{}
+		if err := sub.Next(resp); err != nil {
+			if err == nrpc.ErrEOS {
+				return nil
+			}
+			return err
+		}
+		cb(ctx, resp)
+	}
+}
+{{- end}}
+{{- range .ClientStreamMethodInfo}}
+{{$stream := printf "%s%sStream" $.ClientName .MethodName | goIdent}}
+// {{$stream}} streams the requests of a {{.MethodName}} call
+type {{$stream}} struct {
+	stream *flogoTrigger.ClientStream
+}
+
+// {{.MethodName}} starts a call of the {{.MethodName}} method streaming its requests. Canceling ctx
+// cancels the call.
+func (c *{{$client}}) {{.MethodName}}(ctx context.Context{{range .SubjectParams}}, {{paramArg "param" .}} string{{end}}) (*{{$stream}}, error) {
+	stream, err := flogoTrigger.NewClientStream(ctx, c.nc, {{methodSubject .}}, c.Encoding, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &{{$stream}}{stream: stream}, nil
+}
+
+// Send sends a request of the call
+func (s *{{$stream}}) Send(req *{{.MethodReqName}}) error {
+	return s.stream.Send(req)
+}
+
+// CloseAndRecv ends the requests of the call and returns its reply
+func (s *{{$stream}}) CloseAndRecv() (*{{.MethodResName}}, error) {
+	resp := &{{.MethodResName}}{}
+	if err := s.stream.CloseAndRecv(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+{{- end}}
+{{- range .BiDiStreamMethodInfo}}
+{{$stream := printf "%s%sStream" $.ClientName .MethodName | goIdent}}
+// {{$stream}} exchanges the requests and replies of a {{.MethodName}} call
+type {{$stream}} struct {
+	stream *flogoTrigger.ClientStream
+}
+
+// {{.MethodName}} starts a call of the {{.MethodName}} method streaming its requests and replies.
+// Canceling ctx cancels the call.
+func (c *{{$client}}) {{.MethodName}}(ctx context.Context{{range .SubjectParams}}, {{paramArg "param" .}} string{{end}}) (*{{$stream}}, error) {
+	stream, err := flogoTrigger.NewClientStream(ctx, c.nc, {{methodSubject .}}, c.Encoding, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &{{$stream}}{stream: stream}, nil
+}
+
+// Send sends a request of the call
+func (s *{{$stream}}) Send(req *{{.MethodReqName}}) error {
+	return s.stream.Send(req)
+}
+
+// CloseSend ends the requests of the call, the replies can still be received
+func (s *{{$stream}}) CloseSend() error {
+	return s.stream.CloseSend()
+}
+
+// Recv returns the next reply of the call, io.EOF at the end of the replies
+func (s *{{$stream}}) Recv() (*{{.MethodResName}}, error) {
+	resp := &{{.MethodResName}}{}
+	if err := s.stream.Recv(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close cancels the call
+func (s *{{$stream}}) Close() {
+	s.stream.Close()
+}
+{{- end}}
+{{- define "params"}}{{range .SubjectParams}}{{paramArg "param" .}} string, {{end}}{{end}}
+`))
+
+// GenerateServiceImplFiles writes the support file of each service to dir, named after its proto,
+// its service and option
+func GenerateServiceImplFiles(dir string, pdArr []ProtoData, option string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, pd := range pdArr {
+		pd.Option = option
+
+		var buf bytes.Buffer
+		if err := GenerateServiceImpl(&buf, pd); err != nil {
+			return err
+		}
+
+		fileName := filepath.Join(dir, pd.ProtoName+"."+pd.RegServiceName+"."+option+".nrpcservice.go")
+		if err := ioutil.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateServiceImpl writes the gofmt'ed support file of the service for pd.Option to w
+func GenerateServiceImpl(w io.Writer, pd ProtoData) error {
+	var tmpl *template.Template
+	switch pd.Option {
+	case ServerOption:
+		tmpl = registryServerTemplate
+	case ClientOption:
+		tmpl = registryClientTemplate
+	default:
+		return fmt.Errorf("Unknown support file option: %s", pd.Option)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, pd); err != nil {
+		return fmt.Errorf("Cannot generate %s support file of service %s: %v", pd.Option, pd.RegServiceName, err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("Cannot format %s support file of service %s: %v", pd.Option, pd.RegServiceName, err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// goIdent replaces the characters which cannot appear in a Go identifier
+func goIdent(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// paramArg returns the Go argument of the generated clients taking the value of an nRPC subject
+// parameter
+func paramArg(prefix, name string) string {
+	return goIdent(prefix + schema.CamelCase(name))
+}
+
+// subjectToken is a token of an nRPC subject, either literal or the Go argument taking the value
+// of a subject parameter
+type subjectToken struct {
+	value string
+	param bool
+}
+
+// clientSubject returns the Go expression of the subject of the service called by a client, from
+// the arguments of its constructor
+func clientSubject(pd ProtoData) string {
+	var tokens []subjectToken
+	if pd.PackageSubject != "" {
+		tokens = append(tokens, subjectToken{value: pd.PackageSubject})
+	}
+	for _, name := range pd.PackageParams {
+		tokens = append(tokens, subjectToken{value: paramArg("pkgParam", name), param: true})
+	}
+	tokens = append(tokens, subjectToken{value: pd.ServiceSubject})
+	for _, name := range pd.ServiceParams {
+		tokens = append(tokens, subjectToken{value: paramArg("svcParam", name), param: true})
+	}
+	return subjectExpr("", tokens)
+}
+
+// methodSubject returns the Go expression of the subject of a method called by a client, from the
+// client subject and the arguments of the method
+func methodSubject(method MethodInfoTree) string {
+	tokens := []subjectToken{{value: method.MethodSubject}}
+	for _, name := range method.SubjectParams {
+		tokens = append(tokens, subjectToken{value: paramArg("param", name), param: true})
+	}
+	return subjectExpr("c.Subject", tokens)
+}
+
+// subjectExpr returns the Go expression joining the subject tokens with dots, after the head
+// expression when it is not empty
+func subjectExpr(head string, tokens []subjectToken) string {
+	var exprs []string
+	if head != "" {
+		exprs = append(exprs, head)
+	}
+
+	literal := ""
+	for i, token := range tokens {
+		if i > 0 || head != "" {
+			literal += "."
+		}
+		if !token.param {
+			literal += token.value
+			continue
+		}
+		if literal != "" {
+			exprs = append(exprs, strconv.Quote(literal))
+			literal = ""
+		}
+		exprs = append(exprs, token.value)
+	}
+	if literal != "" {
+		exprs = append(exprs, strconv.Quote(literal))
+	}
+	return strings.Join(exprs, " + ")
+}
+
+// usedImports returns the imports of the message types of the methods
+func usedImports(imports []GoImport, methodLists ...[]MethodInfoTree) []GoImport {
+	var used []GoImport
+	for _, imp := range imports {
+		if importUsed(imp, methodLists) {
+			used = append(used, imp)
+		}
+	}
+	return used
+}
+
+func importUsed(imp GoImport, methodLists [][]MethodInfoTree) bool {
+	for _, methods := range methodLists {
+		for _, method := range methods {
+			if strings.HasPrefix(method.MethodReqName, imp.Name+".") || strings.HasPrefix(method.MethodResName, imp.Name+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
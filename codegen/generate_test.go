@@ -0,0 +1,143 @@
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+type GenerateTestSuite struct {
+	suite.Suite
+}
+
+func (suite *GenerateTestSuite) TestGenerateServiceImplFiles() {
+	t := suite.T()
+
+	pdArr, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "route_guide.proto")
+	assert.Nil(t, err, "GetProtoData error")
+
+	dir, err := ioutil.TempDir("", "flogo-nrpc-codegen")
+	assert.Nil(t, err, "Cannot create temp dir")
+	defer os.RemoveAll(dir)
+
+	for _, option := range []string{ServerOption, ClientOption} {
+		err = GenerateServiceImplFiles(dir, pdArr, option)
+		assert.Nil(t, err, "GenerateServiceImplFiles error for %s", option)
+	}
+
+	src, err := ioutil.ReadFile(filepath.Join(dir, "route_guide.RouteGuide.nrpcserver.nrpcservice.go"))
+	assert.Nil(t, err, "Support file not generated")
+	assert.Contains(t, string(src), `ServiceSubject: "RouteGuide",`)
+	assert.Contains(t, string(src), `NewRequest: func() proto.Message { return &Point{} },`)
+	assert.Contains(t, string(src), `ServerStream: true,`)
+	assert.Contains(t, string(src), `Name:         "RecordRoute",`)
+	assert.Contains(t, string(src), `ClientStream: true,`)
+
+	src, err = ioutil.ReadFile(filepath.Join(dir, "route_guide.RouteGuide.nrpcclient.nrpcservice.go"))
+	assert.Nil(t, err, "Client file not generated")
+	assert.Contains(t, string(src), `func (c *RouteGuideClient) RecordRoute(ctx context.Context) (*RouteGuideRecordRouteStream, error) {`)
+	assert.Contains(t, string(src), `func (s *RouteGuideRecordRouteStream) CloseAndRecv() (*RouteSummary, error) {`)
+	assert.Contains(t, string(src), `func (c *RouteGuideClient) RouteChat(ctx context.Context) (*RouteGuideRouteChatStream, error) {`)
+	assert.Contains(t, string(src), `func (s *RouteGuideRouteChatStream) Recv() (*RouteNote, error) {`)
+}
+
+func (suite *GenerateTestSuite) TestGenerateServiceImplErrors() {
+	t := suite.T()
+
+	pdArr, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "helloworld.proto")
+	assert.Nil(t, err, "GetProtoData error")
+
+	pdArr[0].Option = "grpcserver"
+	err = GenerateServiceImpl(ioutil.Discard, pdArr[0])
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "grpcserver")
+}
+
+// TestGenerateServiceImplCompiles builds the support files generated for the nrpc examples with
+// the messages protoc-gen-go generated for them, in a module using this trigger, and runs the
+// tests calling the services through the generated clients
+func (suite *GenerateTestSuite) TestGenerateServiceImplCompiles() {
+	t := suite.T()
+
+	if testing.Short() {
+		t.Skip("Skipping compilation in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("Skipping compilation, go tool not found")
+	}
+
+	triggerDir, err := filepath.Abs("..")
+	assert.Nil(t, err, "Cannot get trigger module dir")
+
+	importPaths := []string{filepath.Join("testdata", "protos")}
+	for protoFile, srcFiles := range map[string][]string{
+		"helloworld.proto":  {"helloworld.pb.go", "helloworld_client_test.go", "trigger_util_test.go"},
+		"alloptions.proto":  {"alloptions.pb.go", "alloptions_client_test.go"},
+		"route_guide.proto": {"route_guide.pb.go", "route_guide_client_test.go", "trigger_util_test.go"},
+		"greeter.protoset":  {"helloworld.pb.go", "greeter_trigger_test.go", "trigger_util_test.go"},
+	} {
+		dir, err := ioutil.TempDir("", "flogo-nrpc-codegen")
+		assert.Nil(t, err, "Cannot create temp dir")
+		defer os.RemoveAll(dir)
+
+		var pdArr []ProtoData
+		if schema.IsDescriptorSet(protoFile) {
+			// The build step registers the services of the set under the base name of the setting
+			var files []*desc.FileDescriptor
+			files, err = schema.ParseFiles(importPaths, "helloworld.proto")
+			assert.Nil(t, err, "ParseFiles error for %s", protoFile)
+			data, err := proto.Marshal(desc.ToFileDescriptorSet(files...))
+			assert.Nil(t, err, "Cannot marshal descriptor set")
+			pdArr, err = GetDescriptorSetProtoData("main", "greeter", data)
+		} else {
+			pdArr, err = GetProtoData("main", importPaths, protoFile)
+		}
+		assert.Nil(t, err, "Proto data error for %s", protoFile)
+		for _, option := range []string{ServerOption, ClientOption} {
+			err = GenerateServiceImplFiles(dir, pdArr, option)
+			assert.Nil(t, err, "GenerateServiceImplFiles error for %s %s", protoFile, option)
+		}
+
+		files := map[string]string{
+			"go.mod": fmt.Sprintf("module example.com/app\n\ngo 1.13\n\n"+
+				"require github.com/codelity-co/flogo-nrpc-trigger v0.0.0\n\n"+
+				"replace github.com/codelity-co/flogo-nrpc-trigger => %s\n", triggerDir),
+			"main.go": "package main\n\nfunc main() {}\n",
+		}
+		for _, srcFile := range srcFiles {
+			src, err := ioutil.ReadFile(filepath.Join("testdata", "compile", srcFile))
+			assert.Nil(t, err, "Cannot read %s", srcFile)
+
+			// The messages of the examples are generated in their own package
+			files[srcFile] = strings.Replace(string(src), "\npackage helloworld\n", "\npackage main\n", 1)
+		}
+		for name, content := range files {
+			err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			assert.Nil(t, err, "Cannot write %s", name)
+		}
+
+		for _, args := range [][]string{{"build", "./..."}, {"vet", "./..."}, {"test", "./..."}} {
+			cmd := exec.Command(goTool, args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+			output, err := cmd.CombinedOutput()
+			assert.Nil(t, err, "go %s failed for %s:\n%s", strings.Join(args, " "), protoFile, output)
+		}
+	}
+}
+
+func TestGenerateTestSuite(t *testing.T) {
+	suite.Run(t, new(GenerateTestSuite))
+}
@@ -0,0 +1,287 @@
+// Package codegen generates the Go support files registering the nRPC services of proto files
+// with the trigger
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+// MethodInfoTree holds method information
+type MethodInfoTree struct {
+	MethodName        string
+	MethodSubject     string   // nRPC subject token of the method
+	MethodReqName     string   // Go type of the request, qualified when declared in another Go package
+	MethodResName     string   // Go type of the response, qualified when declared in another Go package
+	MethodReqFullName string   // Fully-qualified proto name of the request
+	MethodResFullName string   // Fully-qualified proto name of the response
+	SubjectParams     []string // Names of the nRPC subject parameters following the method subject
+	ClientStream      bool
+	ServerStream      bool // Declared with a stream reply or the nrpc streamedReply option
+	serviceName       string
+}
+
+// GoImport is a Go package imported by the generated code for the messages it declares
+type GoImport struct {
+	Name string
+	Path string
+}
+
+// ProtoData holds proto file data
+type ProtoData struct {
+	Timestamp              time.Time
+	Package                string
+	UnaryMethodInfo        []MethodInfoTree
+	ClientStreamMethodInfo []MethodInfoTree
+	ServerStreamMethodInfo []MethodInfoTree
+	BiDiStreamMethodInfo   []MethodInfoTree
+	AllMethodInfo          []MethodInfoTree
+	ProtoImpPath           string
+	RegServiceName         string
+	ClientName             string // Go name prefix of the client declarations, the proto name is added when several protos declare the service
+	ProtoName              string
+	ProtoPackage           string
+	PackageSubject         string   // nRPC subject prefix of the proto package, may be empty
+	ServiceSubject         string   // nRPC subject token of the service
+	PackageParams          []string // Names of the nRPC subject parameters following the package subject
+	ServiceParams          []string // Names of the nRPC subject parameters following the service subject
+	GoImports              []GoImport
+	Option                 string
+	Stream                 bool
+}
+
+// GetProtoData parses the proto files and returns the data of each service they declare, for
+// support files generated in the goPackage Go package. The proto files and their imports are
+// searched in importPaths.
+func GetProtoData(goPackage string, importPaths []string, fileNames ...string) ([]ProtoData, error) {
+	files, err := schema.ParseFiles(importPaths, fileNames...)
+	if err != nil {
+		return nil, err
+	}
+	return getFilesProtoData(goPackage, "", files), nil
+}
+
+// GetDescriptorSetProtoData returns the data of each service declared by the files of a binary
+// FileDescriptorSet, for support files generated in the goPackage Go package. The services are
+// registered under protoName, the name the trigger settings give to the set, so that the trigger
+// serves all the services of the set. They are registered under the names of their files when
+// protoName is empty.
+func GetDescriptorSetProtoData(goPackage, protoName string, data []byte) ([]ProtoData, error) {
+	files, err := schema.ParseDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+	return getFilesProtoData(goPackage, protoName, files), nil
+}
+
+// getFilesProtoData returns the data of the services of the files, registered under protoName or
+// under the names of their files when empty
+func getFilesProtoData(goPackage, protoName string, files []*desc.FileDescriptor) []ProtoData {
+	var protoDataArr []ProtoData
+
+	timestamp := time.Now()
+	for _, file := range files {
+		fileProtoName := protoName
+		if fileProtoName == "" {
+			fileProtoName = strings.Split(filepath.Base(file.GetName()), ".")[0]
+		}
+		for _, service := range file.GetServices() {
+			protoData := ProtoData{
+				Package:        goPackage,
+				Timestamp:      timestamp,
+				ProtoImpPath:   file.GetName(),
+				RegServiceName: schema.CamelCase(service.GetName()),
+				ClientName:     schema.CamelCase(service.GetName()),
+				ProtoName:      fileProtoName,
+				ProtoPackage:   file.GetPackage(),
+				PackageSubject: schema.PackageSubject(file),
+				ServiceSubject: schema.ServiceSubject(service),
+				PackageParams:  schema.PackageSubjectParams(file),
+				ServiceParams:  schema.ServiceSubjectParams(service),
+			}
+
+			imports := newGoImports(file)
+			for _, method := range service.GetMethods() {
+				protoData.AllMethodInfo = append(protoData.AllMethodInfo, MethodInfoTree{
+					MethodName:        schema.CamelCase(method.GetName()),
+					MethodSubject:     schema.MethodSubject(method),
+					MethodReqName:     imports.goTypeName(method.GetInputType()),
+					MethodResName:     imports.goTypeName(method.GetOutputType()),
+					MethodReqFullName: method.GetInputType().GetFullyQualifiedName(),
+					MethodResFullName: method.GetOutputType().GetFullyQualifiedName(),
+					SubjectParams:     schema.MethodSubjectParams(method),
+					ClientStream:      method.IsClientStreaming(),
+					ServerStream:      method.IsServerStreaming() || schema.StreamedReply(method),
+					serviceName:       protoData.RegServiceName,
+				})
+			}
+			protoData.GoImports = imports.imports
+
+			protoDataArr = append(protoDataArr, protoData)
+		}
+	}
+
+	return arrangeProtoData(protoDataArr)
+}
+
+// MergeProtoData merges the data of the services of several protos generated in the same Go
+// package. A service of the same proto file found twice is kept once, the services named alike in
+// different protos get clients prefixed with their proto name.
+func MergeProtoData(pdArrs ...[]ProtoData) ([]ProtoData, error) {
+	var merged []ProtoData
+	registered := make(map[string]ProtoData)
+	for _, pdArr := range pdArrs {
+		for _, pd := range pdArr {
+			// Registry key of the service and name of its support files
+			key := goIdent(pd.ProtoName + pd.RegServiceName)
+			if other, ok := registered[key]; ok {
+				if other.ProtoImpPath == pd.ProtoImpPath && other.ProtoPackage == pd.ProtoPackage && other.RegServiceName == pd.RegServiceName {
+					continue
+				}
+				return nil, fmt.Errorf("Cannot merge proto data: service %s of %s collides with service %s of %s",
+					pd.RegServiceName, pd.ProtoImpPath, other.RegServiceName, other.ProtoImpPath)
+			}
+			registered[key] = pd
+			merged = append(merged, pd)
+		}
+	}
+
+	services := make(map[string]int, len(merged))
+	for _, pd := range merged {
+		services[pd.RegServiceName]++
+	}
+	for i, pd := range merged {
+		if services[pd.RegServiceName] > 1 {
+			merged[i].ClientName = goIdent(schema.CamelCase(pd.ProtoName) + pd.RegServiceName)
+		}
+	}
+	return merged, nil
+}
+
+// arrangeProtoData refactors different types of methods from all method info list
+func arrangeProtoData(pdArr []ProtoData) []ProtoData {
+
+	for index, protoData := range pdArr {
+		for _, mthdInfo := range protoData.AllMethodInfo {
+			if mthdInfo.ClientStream || mthdInfo.ServerStream {
+				protoData.Stream = true
+			}
+			if !mthdInfo.ClientStream && !mthdInfo.ServerStream {
+				protoData.UnaryMethodInfo = append(protoData.UnaryMethodInfo, mthdInfo)
+			} else if mthdInfo.ClientStream && mthdInfo.ServerStream {
+				protoData.BiDiStreamMethodInfo = append(protoData.BiDiStreamMethodInfo, mthdInfo)
+			} else if mthdInfo.ClientStream {
+				protoData.ClientStreamMethodInfo = append(protoData.ClientStreamMethodInfo, mthdInfo)
+			} else if mthdInfo.ServerStream {
+				protoData.ServerStreamMethodInfo = append(protoData.ServerStreamMethodInfo, mthdInfo)
+			}
+		}
+		pdArr[index] = protoData
+	}
+
+	return pdArr
+}
+
+// nrpcImportPath is the Go package of the nrpc messages, imported as nrpc by the support files
+const nrpcImportPath = "github.com/nats-rpc/nrpc"
+
+// reservedImportNames are the names of the packages imported by the support files templates
+var reservedImportNames = map[string]bool{
+	"context":      true,
+	"flogoTrigger": true,
+	"nats":         true,
+	"nrpc":         true,
+	"proto":        true,
+	"time":         true,
+}
+
+// goImports names the Go packages of the messages used by a proto file
+type goImports struct {
+	goPackage string
+	imports   []GoImport
+	names     map[string]string
+}
+
+func newGoImports(file *desc.FileDescriptor) *goImports {
+	goPackage, _ := goPackageOption(file)
+	return &goImports{
+		goPackage: goPackage,
+		names:     make(map[string]string),
+	}
+}
+
+// goTypeName returns the Go type generated by protoc-gen-go for the message, qualified with its
+// package name when the message is declared in another Go package
+func (g *goImports) goTypeName(message *desc.MessageDescriptor) string {
+	name := strings.TrimPrefix(message.GetFullyQualifiedName(), message.GetFile().GetPackage()+".")
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = schema.CamelCase(part)
+	}
+	typeName := strings.Join(parts, "_")
+
+	goPackage, goName := goPackageOption(message.GetFile())
+	if goPackage == g.goPackage {
+		return typeName
+	}
+	return g.importName(goPackage, goName) + "." + typeName
+}
+
+// importName returns the name the Go package is imported with, unique among the imports
+func (g *goImports) importName(goPackage, goName string) string {
+	if name, ok := g.names[goPackage]; ok {
+		return name
+	}
+
+	name := goName
+	if goPackage == nrpcImportPath {
+		name = "nrpc"
+	}
+	for i := 1; goPackage != nrpcImportPath && g.nameUsed(name); i++ {
+		name = fmt.Sprintf("%s%d", goName, i)
+	}
+	g.names[goPackage] = name
+	g.imports = append(g.imports, GoImport{Name: name, Path: goPackage})
+	return name
+}
+
+func (g *goImports) nameUsed(name string) bool {
+	if reservedImportNames[name] {
+		return true
+	}
+	for _, imp := range g.imports {
+		if imp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// goPackageOption returns the Go import path and package name of the file, from its go_package
+// option or from its proto package when the option is not set
+func goPackageOption(file *desc.FileDescriptor) (string, string) {
+	goPackage := file.GetFileOptions().GetGoPackage()
+	if goPackage == "" {
+		return "", cleanPackageName(file.GetPackage())
+	}
+
+	importPath, name := goPackage, ""
+	if i := strings.Index(goPackage, ";"); i >= 0 {
+		importPath, name = goPackage[:i], goPackage[i+1:]
+	}
+	if name == "" {
+		name = path.Base(importPath)
+	}
+	return importPath, cleanPackageName(name)
+}
+
+func cleanPackageName(name string) string {
+	return strings.NewReplacer(".", "_", "-", "_", "/", "_").Replace(name)
+}
@@ -0,0 +1,187 @@
+package codegen
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+type ProtoTestSuite struct {
+	suite.Suite
+}
+
+// assertGolden compares the proto data with testdata/golden/<name>.json
+func (suite *ProtoTestSuite) assertGolden(name string, pdArr []ProtoData) {
+	t := suite.T()
+
+	for i := range pdArr {
+		pdArr[i].Timestamp = time.Time{}
+	}
+	actual, err := json.MarshalIndent(pdArr, "", "  ")
+	assert.Nil(t, err, "Cannot marshal proto data")
+
+	goldenFile := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		err = ioutil.WriteFile(goldenFile, append(actual, '\n'), 0644)
+		assert.Nil(t, err, "Cannot update golden file")
+	}
+
+	expected, err := ioutil.ReadFile(goldenFile)
+	assert.Nil(t, err, "Cannot read golden file")
+	assert.Equal(t, string(expected), string(actual)+"\n", "Proto data differs from %s", goldenFile)
+}
+
+func (suite *ProtoTestSuite) TestGetProtoDataGolden() {
+	t := suite.T()
+
+	for _, fileName := range []string{
+		"helloworld.proto",
+		"alloptions.proto",
+		"route_guide.proto",
+		"acme/billing.proto",
+	} {
+		pdArr, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, fileName)
+		assert.Nil(t, err, "GetProtoData error for %s", fileName)
+		suite.assertGolden(strings.TrimSuffix(filepath.Base(fileName), ".proto"), pdArr)
+	}
+}
+
+func (suite *ProtoTestSuite) TestGetProtoDataMultipleFiles() {
+	t := suite.T()
+
+	pdArr, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "helloworld.proto", "acme/billing.proto")
+	assert.Nil(t, err, "GetProtoData error")
+
+	var services []string
+	for _, pd := range pdArr {
+		services = append(services, pd.ProtoName+"."+pd.RegServiceName)
+	}
+	assert.Equal(t, []string{"helloworld.Greeter", "billing.BillingService", "billing.InvoiceEvents"}, services)
+}
+
+func (suite *ProtoTestSuite) TestGetDescriptorSetProtoData() {
+	t := suite.T()
+
+	for _, fileName := range []string{
+		"helloworld.proto",
+		"alloptions.proto",
+		"route_guide.proto",
+		"acme/billing.proto",
+	} {
+		files, err := schema.ParseFiles([]string{filepath.Join("testdata", "protos")}, fileName)
+		if !assert.Nil(t, err, "ParseFiles error for %s", fileName) {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(fileName), ".proto")
+
+		// protoc --include_imports
+		data, err := proto.Marshal(desc.ToFileDescriptorSet(files...))
+		assert.Nil(t, err, "Cannot marshal descriptor set")
+		pdArr, err := GetDescriptorSetProtoData("main", "", data)
+		assert.Nil(t, err, "GetDescriptorSetProtoData error for %s", fileName)
+		suite.assertGolden(name, pdArr)
+
+		// The well-known types and nrpc options are known when the imports are not included
+		data, err = proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{files[0].AsFileDescriptorProto()}})
+		assert.Nil(t, err, "Cannot marshal descriptor set")
+		pdArr, err = GetDescriptorSetProtoData("main", "", data)
+		if fileName == "acme/billing.proto" {
+			// Imports another file of the project
+			assert.NotNil(t, err, "Expected an error for a missing import")
+			continue
+		}
+		assert.Nil(t, err, "GetDescriptorSetProtoData error for %s without imports", fileName)
+		suite.assertGolden(name, pdArr)
+	}
+
+	_, err := GetDescriptorSetProtoData("main", "", []byte("not a descriptor set"))
+	assert.NotNil(t, err)
+
+	// The services of every file of a set are registered under the name of the set
+	files, err := schema.ParseFiles([]string{filepath.Join("testdata", "protos")}, "helloworld.proto", "route_guide.proto")
+	if assert.Nil(t, err, "ParseFiles error") {
+		data, err := proto.Marshal(desc.ToFileDescriptorSet(files...))
+		assert.Nil(t, err, "Cannot marshal descriptor set")
+		pdArr, err := GetDescriptorSetProtoData("main", "api", data)
+		assert.Nil(t, err, "GetDescriptorSetProtoData error")
+
+		services := make(map[string]string)
+		for _, pd := range pdArr {
+			services[pd.RegServiceName] = pd.ProtoName
+		}
+		assert.Equal(t, map[string]string{"Greeter": "api", "RouteGuide": "api"}, services)
+	}
+}
+
+func (suite *ProtoTestSuite) TestMergeProtoData() {
+	t := suite.T()
+
+	helloworld, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "helloworld.proto")
+	assert.Nil(t, err, "GetProtoData error")
+	billing, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "acme/billing.proto")
+	assert.Nil(t, err, "GetProtoData error")
+
+	// The same proto used by two triggers is generated once
+	merged, err := MergeProtoData(helloworld, billing, helloworld)
+	assert.Nil(t, err, "MergeProtoData error")
+	var clients []string
+	for _, pd := range merged {
+		clients = append(clients, pd.ClientName)
+	}
+	assert.Equal(t, []string{"Greeter", "BillingService", "InvoiceEvents"}, clients)
+
+	// Services named alike in different protos get distinct clients
+	greeter := append([]ProtoData(nil), helloworld...)
+	greeter[0].ProtoName = "greeter_v2"
+	greeter[0].ProtoImpPath = "greeter_v2.proto"
+	merged, err = MergeProtoData(helloworld, greeter)
+	assert.Nil(t, err, "MergeProtoData error")
+	if assert.Len(t, merged, 2) {
+		assert.Equal(t, "HelloworldGreeter", merged[0].ClientName)
+		assert.Equal(t, "GreeterV2Greeter", merged[1].ClientName)
+		assert.Equal(t, "Greeter", helloworld[0].ClientName, "The merged protos are not modified")
+	}
+
+	// Protos named alike in different directories would register the same service
+	collision := append([]ProtoData(nil), helloworld...)
+	collision[0].ProtoImpPath = "v2/helloworld.proto"
+	_, err = MergeProtoData(helloworld, collision)
+	if assert.NotNil(t, err, "Expected a collision error") {
+		assert.Contains(t, err.Error(), "v2/helloworld.proto")
+	}
+}
+
+func (suite *ProtoTestSuite) TestGetProtoDataErrors() {
+	t := suite.T()
+
+	_, err := GetProtoData("main", []string{filepath.Join("testdata", "protos")}, "missing.proto")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "missing.proto")
+
+	dir, err := ioutil.TempDir("", "flogo-nrpc-codegen")
+	assert.Nil(t, err, "Cannot create temp dir")
+	err = ioutil.WriteFile(filepath.Join(dir, "broken.proto"), []byte(`syntax = "proto3"; service Broken { rpc Get(Unknown) returns (Unknown); }`), 0644)
+	assert.Nil(t, err, "Cannot write proto")
+
+	_, err = GetProtoData("main", []string{dir}, "broken.proto")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unknown")
+}
+
+func TestProtoTestSuite(t *testing.T) {
+	suite.Run(t, new(ProtoTestSuite))
+}
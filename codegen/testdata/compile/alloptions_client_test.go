@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestSvcCustomSubjectClientStreamedReply receives the replies of a method served with the nrpc
+// streamed reply protocol through the generated client
+func TestSvcCustomSubjectClientStreamedReply(t *testing.T) {
+	s := natsserver.RunRandClientPortServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	_, err = nc.Subscribe("root.i1.custom_subject.mtstreamedreply", func(msg *nats.Msg) {
+		request := nrpc.NewRequest(context.Background(), nc, msg.Subject, msg.Reply)
+		request.Encoding = "protobuf"
+		request.EnableStreamedReply()
+		request.Handler = func(ctx context.Context) (proto.Message, error) {
+			req := &StringArg{}
+			if err := nrpc.Unmarshal("protobuf", msg.Data, req); err != nil {
+				return nil, err
+			}
+			for _, reply := range strings.Split(req.Arg1, ",") {
+				if reply == "fail" {
+					return nil, &nrpc.Error{Type: nrpc.Error_SERVER, Message: "failed"}
+				}
+				request.SendStreamReply(&SimpleStringReply{Reply: reply})
+			}
+			return nil, nil
+		}
+		go request.RunAndReply()
+	})
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	client := NewSvcCustomSubjectClient(nc, "i1")
+
+	var replies []string
+	err = client.MtStreamedReply(context.Background(), &StringArg{Arg1: "a,b,c"}, func(ctx context.Context, reply *SimpleStringReply) {
+		replies = append(replies, reply.Reply)
+	})
+	if err != nil {
+		t.Fatalf("MtStreamedReply error: %v", err)
+	}
+	if strings.Join(replies, ",") != "a,b,c" {
+		t.Errorf("Unexpected replies: %v", replies)
+	}
+
+	err = client.MtStreamedReply(context.Background(), &StringArg{Arg1: "a,fail"}, func(ctx context.Context, reply *SimpleStringReply) {})
+	if nrpcErr, ok := err.(*nrpc.Error); !ok || nrpcErr.Message != "failed" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestSvcSubjectParamsClient calls methods with subject parameters through the generated client
+func TestSvcSubjectParamsClient(t *testing.T) {
+	s := natsserver.RunRandClientPortServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	// The subject of the call is replied
+	_, err = nc.Subscribe("root.*.svcsubjectparams.*.>", func(msg *nats.Msg) {
+		data, err := nrpc.Marshal("protobuf", &SimpleStringReply{Reply: msg.Subject})
+		if err == nil {
+			err = msg.Respond(data)
+		}
+		if err != nil {
+			t.Errorf("Cannot reply: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	client := NewSvcSubjectParamsClient(nc, "i1", "c1")
+
+	reply, err := client.MtWithSubjectParams("a", "b", &nrpc.Void{})
+	if err != nil {
+		t.Fatalf("MtWithSubjectParams error: %v", err)
+	}
+	if reply.Reply != "root.i1.svcsubjectparams.c1.mtwithsubjectparams.a.b" {
+		t.Errorf("Unexpected subject: %s", reply.Reply)
+	}
+
+	reply, err = client.MtNoRequestWParams("a", &nrpc.NoRequest{})
+	if err != nil {
+		t.Fatalf("MtNoRequestWParams error: %v", err)
+	}
+	if reply.Reply != "root.i1.svcsubjectparams.c1.mtnorequestwparams.a" {
+		t.Errorf("Unexpected subject: %s", reply.Reply)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	nats "github.com/nats-io/nats.go"
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+)
+
+// TestGreeterDescriptorSet serves the Greeter generated from a descriptor set with the trigger
+// configured with the set file only
+func TestGreeterDescriptorSet(t *testing.T) {
+	s := runServer()
+	defer s.Shutdown()
+
+	trg := startTrigger(t, s, map[string]interface{}{"protoFile": "protos/greeter.protoset"},
+		&testHandler{
+			settings: map[string]interface{}{"serviceName": "Greeter", "methodName": "SayHello"},
+			handle: func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error) {
+				return map[string]interface{}{"data": map[string]interface{}{"message": "Hello " + out.ProtobufRequestMap["name"].(string)}}, nil
+			},
+		},
+	)
+	defer trg.Stop()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	resp, err := NewGreeterClient(nc).SayHello(&HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatalf("SayHello error: %v", err)
+	}
+	if resp.Message != "Hello world" {
+		t.Errorf("Unexpected reply: %q", resp.Message)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+)
+
+// TestGreeterClient calls a Greeter served with the nrpc protocol through the generated client
+func TestGreeterClient(t *testing.T) {
+	s := natsserver.RunRandClientPortServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	_, err = nc.Subscribe("Greeter.SayHello", func(msg *nats.Msg) {
+		req := &HelloRequest{}
+		if err := nrpc.Unmarshal("protobuf", msg.Data, req); err != nil {
+			_ = nrpc.Publish(nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: err.Error()}, nc, msg.Reply, "protobuf")
+			return
+		}
+		if req.Name == "" {
+			_ = nrpc.Publish(nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "missing name"}, nc, msg.Reply, "protobuf")
+			return
+		}
+		_ = nrpc.Publish(&HelloReply{Message: "Hello " + req.Name}, nil, nc, msg.Reply, "protobuf")
+	})
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	client := NewGreeterClient(nc)
+	resp, err := client.SayHello(&HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatalf("SayHello error: %v", err)
+	}
+	if resp.Message != "Hello world" {
+		t.Errorf("Unexpected reply: %q", resp.Message)
+	}
+
+	_, err = client.SayHello(&HelloRequest{})
+	if nrpcErr, ok := err.(*nrpc.Error); !ok || nrpcErr.Message != "missing name" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestGreeterClientSubjectPrefix calls a Greeter served under a subject prefix
+func TestGreeterClientSubjectPrefix(t *testing.T) {
+	s := natsserver.RunRandClientPortServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	_, err = nc.Subscribe("dev.alice.Greeter.SayHello", func(msg *nats.Msg) {
+		_ = nrpc.Publish(&HelloReply{Message: "Hello dev"}, nil, nc, msg.Reply, "protobuf")
+	})
+	if err != nil {
+		t.Fatalf("Cannot subscribe: %v", err)
+	}
+
+	client := NewGreeterClient(nc).WithSubjectPrefix("dev.alice")
+	resp, err := client.SayHello(&HelloRequest{Name: "world"})
+	if err != nil {
+		t.Fatalf("SayHello error: %v", err)
+	}
+	if resp.Message != "Hello dev" {
+		t.Errorf("Unexpected reply: %q", resp.Message)
+	}
+}
+
+// TestGreeterClientDurable calls a Greeter served by a trigger in durable mode through the
+// generated client, the requests are stored in JetStream without their reply subject
+func TestGreeterClientDurable(t *testing.T) {
+	s, shutdown := runJetStreamServer(t)
+	defer shutdown()
+
+	trg := startTrigger(t, s, map[string]interface{}{"protoFile": "helloworld.proto", "enableStreaming": true},
+		&testHandler{
+			settings: map[string]interface{}{"serviceName": "Greeter", "methodName": "SayHello"},
+			handle: func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error) {
+				return map[string]interface{}{"data": map[string]interface{}{"message": "Hello " + out.ProtobufRequestMap["name"].(string)}}, nil
+			},
+		},
+	)
+	defer trg.Stop()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	resp, err := NewGreeterClient(nc).SayHello(&HelloRequest{Name: "durable"})
+	if err != nil {
+		t.Fatalf("SayHello error: %v", err)
+	}
+	if resp.Message != "Hello durable" {
+		t.Errorf("Unexpected reply: %q", resp.Message)
+	}
+}
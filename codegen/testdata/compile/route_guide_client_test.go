@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+)
+
+// TestRouteGuideClientTimeout checks the trigger receives the timeout of the generated client calls
+func TestRouteGuideClientTimeout(t *testing.T) {
+	s := runServer()
+	defer s.Shutdown()
+
+	// The replies carry the timeout header of the call, when the flow runs with a deadline
+	timeout := func(out *flogoTrigger.Output) string {
+		if _, ok := out.Metadata["deadline"]; !ok {
+			return ""
+		}
+		return out.Headers[flogoTrigger.TimeoutHeader]
+	}
+	trg := startTrigger(t, s, map[string]interface{}{"protoFile": "route_guide.proto"},
+		&testHandler{
+			settings: map[string]interface{}{"serviceName": "RouteGuide", "methodName": "GetFeature"},
+			handle: func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error) {
+				return map[string]interface{}{"data": map[string]interface{}{"name": timeout(out)}}, nil
+			},
+		},
+		&testHandler{
+			settings: map[string]interface{}{"serviceName": "RouteGuide", "methodName": "ListFeatures"},
+			handle: func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error) {
+				return map[string]interface{}{"data": []interface{}{map[string]interface{}{"name": timeout(out)}}}, nil
+			},
+		},
+		&testHandler{
+			settings: map[string]interface{}{"serviceName": "RouteGuide", "methodName": "RecordRoute"},
+			handle: func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error) {
+				elapsed, _ := strconv.Atoi(timeout(out))
+				return map[string]interface{}{"data": map[string]interface{}{"elapsedTime": elapsed}}, nil
+			},
+		},
+	)
+	defer trg.Stop()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Cannot connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	client := NewRouteGuideClient(nc)
+	client.Timeout = 1500 * time.Millisecond
+
+	feature, err := client.GetFeature(&Point{})
+	if err != nil {
+		t.Fatalf("GetFeature error: %v", err)
+	}
+	if feature.Name != "1500" {
+		t.Errorf("Unexpected GetFeature timeout: %q", feature.Name)
+	}
+
+	var names []string
+	err = client.ListFeatures(context.Background(), &Rectangle{}, func(ctx context.Context, feature *Feature) {
+		names = append(names, feature.Name)
+	})
+	if err != nil {
+		t.Fatalf("ListFeatures error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "1500" {
+		t.Errorf("Unexpected ListFeatures timeouts: %q", names)
+	}
+
+	stream, err := client.RecordRoute(context.Background())
+	if err != nil {
+		t.Fatalf("RecordRoute error: %v", err)
+	}
+	if err := stream.Send(&Point{Latitude: 1}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv error: %v", err)
+	}
+	if summary.ElapsedTime != 1500 {
+		t.Errorf("Unexpected RecordRoute timeout: %d", summary.ElapsedTime)
+	}
+}
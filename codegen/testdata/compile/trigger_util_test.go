@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+
+	flogoTrigger "github.com/codelity-co/flogo-nrpc-trigger"
+)
+
+// testHandler is a trigger.Handler calling handle with the trigger output of each call
+type testHandler struct {
+	settings map[string]interface{}
+	handle   func(ctx context.Context, out *flogoTrigger.Output) (map[string]interface{}, error)
+}
+
+func (h *testHandler) Name() string {
+	return ""
+}
+
+func (h *testHandler) Settings() map[string]interface{} {
+	return h.settings
+}
+
+func (h *testHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *testHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	return h.handle(ctx, triggerData.(*flogoTrigger.Output))
+}
+
+// testInitContext is a trigger.InitContext with preset handlers
+type testInitContext struct {
+	handlers []trigger.Handler
+}
+
+func (ctx *testInitContext) GetHandlers() []trigger.Handler {
+	return ctx.handlers
+}
+
+func (ctx *testInitContext) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+// startTrigger starts a trigger serving the services of the generated support files on s with the
+// given settings and handlers
+func startTrigger(t *testing.T, s *server.Server, settings map[string]interface{}, handlers ...trigger.Handler) trigger.Trigger {
+	triggerSettings := map[string]interface{}{"natsClusterUrls": s.ClientURL()}
+	for k, v := range settings {
+		triggerSettings[k] = v
+	}
+
+	f := trigger.GetFactory(support.GetRef(&flogoTrigger.Trigger{}))
+	trg, err := f.New(&trigger.Config{Id: "flogo-nrpc-trigger", Settings: triggerSettings})
+	if err != nil {
+		t.Fatalf("Cannot create trigger: %v", err)
+	}
+	if err := trg.Initialize(&testInitContext{handlers: handlers}); err != nil {
+		t.Fatalf("Initialize error: %v", err)
+	}
+	if err := trg.Start(); err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	return trg
+}
+
+// runServer runs a NATS server on a random port, with headers support
+func runServer() *server.Server {
+	return natsserver.RunRandClientPortServer()
+}
+
+// runJetStreamServer runs a NATS server with JetStream on a random port, the returned func shuts it
+// down and removes its store
+func runJetStreamServer(t *testing.T) (*server.Server, func()) {
+	storeDir, err := ioutil.TempDir("", "flogo-nrpc-jetstream")
+	if err != nil {
+		t.Fatalf("Cannot create JetStream store dir: %v", err)
+	}
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = storeDir
+	s := natsserver.RunServer(&opts)
+	return s, func() {
+		s.Shutdown()
+		os.RemoveAll(storeDir)
+	}
+}
@@ -0,0 +1,264 @@
+package nrpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+)
+
+// ReplyToHeader is the NATS header carrying the nRPC reply subject of the requests published to
+// the JetStream stream in durable mode, JetStream does not keep the reply subject of stored messages.
+// The generated clients and ClientStream set it on every request.
+const ReplyToHeader = "Nrpc-Reply-To"
+
+// deliveryHeader is the NATS header carrying the JetStream delivery of a durable request to the
+// subscription callback serving it, it is not part of the request headers
+const deliveryHeader = "Nrpc-Delivery"
+
+// durableFetchWait is how long a durable fetcher waits for requests before checking its subscription
+const durableFetchWait = time.Second
+
+// deliveryTracker records the flow outcome of the durable requests being served, by JetStream
+// delivery. A request redelivered while its previous delivery still runs is tracked apart.
+type deliveryTracker struct {
+	deliveries map[string]*delivery
+	mutex      sync.Mutex
+}
+
+// delivery is the outcome of a durable request, final for its last delivery
+type delivery struct {
+	final      bool
+	dispatched bool
+	err        error
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{deliveries: make(map[string]*delivery)}
+}
+
+// deliveryKey returns the key of a JetStream delivery, its stream and consumer sequences
+func deliveryKey(meta *nats.MsgMetadata) string {
+	return strconv.FormatUint(meta.Sequence.Stream, 10) + "." + strconv.FormatUint(meta.Sequence.Consumer, 10)
+}
+
+func (d *deliveryTracker) track(key string, final bool) *delivery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	dl := &delivery{final: final}
+	d.deliveries[key] = dl
+	return dl
+}
+
+func (d *deliveryTracker) untrack(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.deliveries, key)
+}
+
+// complete records the flow outcome of the nRPC request served with ctx, it is ignored when
+// the request is not a durable one
+func (d *deliveryTracker) complete(ctx context.Context, err error) {
+	key, ok := ctx.Value(deliveryContextKey{}).(string)
+	if !ok {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if dl, ok := d.deliveries[key]; ok {
+		dl.dispatched = true
+		dl.err = err
+	}
+}
+
+// redelivered reports whether the durable request served with ctx is delivered again, its flow
+// failed with a server error before the last delivery. The caller is only replied once the
+// delivery is final.
+func (d *deliveryTracker) redelivered(ctx context.Context) bool {
+	key, ok := ctx.Value(deliveryContextKey{}).(string)
+	if !ok {
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	dl, ok := d.deliveries[key]
+	return ok && dl.dispatched && dl.err != nil && !isClientError(dl.err) && !dl.final
+}
+
+// result returns the outcome of dl once cb returned
+func (d *deliveryTracker) result(dl *delivery) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return dl.dispatched, dl.err
+}
+
+// durableSubscribe subscribes subject through a JetStream durable pull consumer, the requests are
+// fetched by workerPoolSize fetchers calling cb and acknowledged once the Flogo flow succeeded
+func (h *Handler) durableSubscribe(subject string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	js, err := h.natsConn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	streamName := h.triggerSettings.streamName()
+	if err := h.ensureStream(js, streamName, subject); err != nil {
+		return nil, err
+	}
+
+	sub, err := js.PullSubscribe(subject, durableConsumerName(h.triggerSettings.durableName(), subject),
+		nats.BindStream(streamName),
+		nats.ManualAck(),
+		nats.AckWait(h.triggerSettings.ackWait()),
+		nats.MaxDeliver(h.triggerSettings.maxDeliver()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < h.triggerSettings.workerPoolSize(); i++ {
+		h.fetchersRunning.Add(1)
+		go func() {
+			defer h.fetchersRunning.Done()
+			h.fetchDurableMsgs(sub, cb)
+		}()
+	}
+
+	return sub, nil
+}
+
+// ensureStream creates the stream storing the requests of subject, or adds subject to the existing stream
+func (h *Handler) ensureStream(js nats.JetStreamContext, streamName, subject string) error {
+	if !streamExists(js, streamName) {
+		h.logger.Infof("Creating JetStream stream [%s] for nRPC subject [%s]", streamName, subject)
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:     streamName,
+			Subjects: []string{subject},
+			NoAck:    true,
+		})
+		return err
+	}
+
+	info, err := js.StreamInfo(streamName)
+	if err != nil {
+		return err
+	}
+	if !info.Config.NoAck {
+		h.logger.Warnf("JetStream stream [%s] acknowledges published messages, nRPC clients will receive the acknowledgement as reply", streamName)
+	}
+	for _, streamSubject := range info.Config.Subjects {
+		if streamSubject == subject {
+			return nil
+		}
+	}
+
+	h.logger.Infof("Adding nRPC subject [%s] to JetStream stream [%s]", subject, streamName)
+	config := info.Config
+	config.Subjects = append(config.Subjects, subject)
+	_, err = js.UpdateStream(&config)
+	return err
+}
+
+// streamExists reports whether the JetStream stream is defined, the stream names are listed since
+// the JetStream API errors are not typed by the NATS client. A stream which cannot be listed is
+// reported missing so that its creation fails.
+func streamExists(js nats.JetStreamContext, streamName string) bool {
+	exists := false
+	for name := range js.StreamNames() {
+		exists = exists || name == streamName
+	}
+	return exists
+}
+
+// fetchDurableMsgs serves the requests of sub one at a time until the handler is closed
+func (h *Handler) fetchDurableMsgs(sub *nats.Subscription, cb nats.MsgHandler) {
+	for !h.isClosing() && sub.IsValid() {
+		msgs, err := sub.Fetch(1, nats.MaxWait(durableFetchWait))
+		if err != nil {
+			if err != nats.ErrTimeout && sub.IsValid() {
+				h.logger.Warnf("Fetching nRPC requests of subject [%s] failed: %v", sub.Subject, err)
+				time.Sleep(durableFetchWait)
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			h.handleDurableMsg(msg, cb)
+		}
+	}
+}
+
+// handleDurableMsg serves a request delivered by JetStream with cb, as if it was received on the
+// nRPC subject, then acknowledges it. Failed flows are redelivered without reply until maxDeliver
+// is reached, requests which cannot succeed are terminated. The flows of durable methods may run
+// more than once and should be idempotent.
+func (h *Handler) handleDurableMsg(msg *nats.Msg, cb nats.MsgHandler) {
+	replySubject := msg.Header.Get(ReplyToHeader)
+	if replySubject == "" {
+		h.logger.Warnf("Dropping nRPC request on subject [%s] without %s header", msg.Subject, ReplyToHeader)
+		h.ackDurableMsg(msg, msg.Term)
+		return
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		h.logger.Warnf("Dropping nRPC request on subject [%s] without JetStream metadata: %v", msg.Subject, err)
+		h.ackDurableMsg(msg, msg.Term)
+		return
+	}
+	key := deliveryKey(meta)
+	dl := h.deliveries.track(key, meta.NumDelivered >= uint64(h.triggerSettings.maxDeliver()))
+	defer h.deliveries.untrack(key)
+
+	header := make(nats.Header, len(msg.Header)+1)
+	for name, values := range msg.Header {
+		header[name] = values
+	}
+	header.Set(deliveryHeader, key)
+	cb(&nats.Msg{
+		Subject: msg.Subject,
+		Reply:   replySubject,
+		Header:  header,
+		Data:    msg.Data,
+	})
+
+	dispatched, err := h.deliveries.result(dl)
+	switch {
+	case !dispatched:
+		// Rejected before reaching a flow, e.g. a malformed request
+		h.ackDurableMsg(msg, msg.Term)
+	case err == nil:
+		h.ackDurableMsg(msg, msg.Ack)
+	case isClientError(err), dl.final:
+		h.ackDurableMsg(msg, msg.Term)
+	default:
+		h.ackDurableMsg(msg, msg.Nak)
+	}
+}
+
+func (h *Handler) ackDurableMsg(msg *nats.Msg, ack func(...nats.AckOpt) error) {
+	if err := ack(); err != nil {
+		h.logger.Errorf("Acknowledging nRPC request on subject [%s] failed: %v", msg.Subject, err)
+	}
+}
+
+// isClientError reports whether err is an nRPC client error, which redelivery cannot fix
+func isClientError(err error) bool {
+	nrpcErr, ok := err.(*nrpc.Error)
+	return ok && nrpcErr.Type == nrpc.Error_CLIENT
+}
+
+// durableConsumerName returns the JetStream durable consumer name of subject, consumer names
+// cannot contain subject tokens separators nor wildcards
+func durableConsumerName(prefix, subject string) string {
+	return prefix + "-" + strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(subject)
+}
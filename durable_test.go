@@ -0,0 +1,297 @@
+package nrpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	jsserver "github.com/nats-io/nats-server/v2/server"
+	jsserverTest "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const durableTestURL = "nats://localhost:4225"
+
+type DurableTestSuite struct {
+	suite.Suite
+	storeDir string
+	server   *jsserver.Server
+}
+
+func (suite *DurableTestSuite) SetupTest() {
+	var err error
+
+	suite.storeDir, err = ioutil.TempDir("", "flogo-nrpc-jetstream")
+	suite.Require().Nil(err, "Cannot create JetStream store dir")
+
+	opts := jsserverTest.DefaultTestOptions
+	opts.Port = 4225
+	opts.JetStream = true
+	opts.StoreDir = suite.storeDir
+	suite.server = jsserverTest.RunServer(&opts)
+}
+
+func (suite *DurableTestSuite) TearDownTest() {
+	suite.server.Shutdown()
+	os.RemoveAll(suite.storeDir)
+}
+
+// request publishes an nRPC request to the stream and waits for its reply
+func (suite *DurableTestSuite) request(nc *nats.Conn, subject string, data string) (string, error) {
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	suite.Require().Nil(err, "Cannot subscribe reply inbox")
+	defer sub.Unsubscribe()
+
+	err = suite.publish(nc, subject, data, inbox)
+	suite.Require().Nil(err, "Cannot publish request")
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		return "", err
+	}
+	return string(msg.Data), nil
+}
+
+// publish publishes an nRPC request to the stream as the generated clients do
+func (suite *DurableTestSuite) publish(nc *nats.Conn, subject string, data string, replySubject string) error {
+	return publishRequest(nc, subject, replySubject, []byte(data), 5*time.Second)
+}
+
+// consumerInfo returns the durable consumer of the EchoService subject
+func (suite *DurableTestSuite) consumerInfo(nc *nats.Conn) *nats.ConsumerInfo {
+	js, err := nc.JetStream()
+	suite.Require().Nil(err, "Cannot get JetStream context")
+	info, err := js.ConsumerInfo(defaultStreamName, durableConsumerName(defaultDurableName, "EchoService.*"))
+	suite.Require().Nil(err, "Cannot get consumer info")
+	return info
+}
+
+func (suite *DurableTestSuite) TestDurableConsumerName() {
+	t := suite.T()
+
+	assert.Equal(t, "flogo-nrpc-trigger-EchoService__", durableConsumerName(defaultDurableName, "EchoService.*"))
+	assert.Equal(t, "orders-orders_OrderService__", durableConsumerName("orders", "orders.OrderService.>"))
+}
+
+func (suite *DurableTestSuite) TestDeliveryTracker() {
+	t := suite.T()
+
+	// The delivery is moved from the request headers to its context
+	msg := nats.NewMsg("EchoService.Echo")
+	msg.Header.Set(deliveryHeader, "1.2")
+	msg.Header.Set("App", "test")
+	ctx, cancel := requestContext(msg)
+	defer cancel()
+	assert.Equal(t, "1.2", ctx.Value(deliveryContextKey{}))
+	assert.Equal(t, map[string]string{"App": "test"}, requestHeaders(ctx))
+
+	// A redelivery of the request running with the first delivery is tracked apart
+	d := newDeliveryTracker()
+	first := d.track("1.1", false)
+	second := d.track("1.2", false)
+	d.complete(ctx, nil)
+	d.untrack("1.2")
+	d.complete(context.WithValue(context.Background(), deliveryContextKey{}, "1.1"), errors.New("flow failed"))
+
+	dispatched, err := d.result(first)
+	assert.True(t, dispatched)
+	assert.EqualError(t, err, "flow failed")
+	dispatched, err = d.result(second)
+	assert.True(t, dispatched)
+	assert.Nil(t, err)
+}
+
+func (suite *DurableTestSuite) TestStreamExists() {
+	t := suite.T()
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+	js, err := nc.JetStream()
+	assert.Nil(t, err, "Cannot get JetStream context")
+
+	assert.False(t, streamExists(js, "orders"))
+	_, err = js.AddStream(&nats.StreamConfig{Name: "orders", Subjects: []string{"orders.>"}})
+	assert.Nil(t, err, "Cannot create stream")
+	assert.True(t, streamExists(js, "orders"))
+	assert.False(t, streamExists(js, "payments"))
+}
+
+func (suite *DurableTestSuite) TestDurableRequestReply() {
+	t := suite.T()
+
+	trg := startTestTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+	}, newEchoTriggerHandler(map[string]interface{}{}, ""))
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	reply, err := suite.request(nc, "EchoService.Echo", `{"message":"durable"}`)
+	assert.Nil(t, err, "Request error")
+	assert.Equal(t, `{"message":"durable"}`, reply)
+
+	err = trg.Stop()
+	assert.Nil(t, err, "Stop error")
+
+	// The request was acknowledged, the durable consumer is kept across restarts
+	info := suite.consumerInfo(nc)
+	assert.Equal(t, 0, info.NumAckPending)
+	assert.Equal(t, uint64(0), info.NumPending)
+	assert.Equal(t, uint64(1), info.AckFloor.Consumer)
+}
+
+func (suite *DurableTestSuite) TestDurableRequestDuringOutage() {
+	t := suite.T()
+
+	trg := startTestTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+	}, newEchoTriggerHandler(map[string]interface{}{}, ""))
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+
+	err := trg.Stop()
+	assert.Nil(t, err, "Stop error")
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// The request is stored while the trigger is stopped
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	assert.Nil(t, err, "Cannot subscribe reply inbox")
+	err = suite.publish(nc, "EchoService.Echo", `{"message":"stored"}`, inbox)
+	assert.Nil(t, err, "Cannot publish request")
+	_, err = sub.NextMsg(200 * time.Millisecond)
+	assert.Equal(t, nats.ErrTimeout, err, "No reply expected during the outage")
+
+	trg = startTestTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+	}, newEchoTriggerHandler(map[string]interface{}{}, ""))
+	defer trg.Stop()
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	assert.Nil(t, err, "Stored request should be served after restart")
+	if msg != nil {
+		assert.Equal(t, `{"message":"stored"}`, string(msg.Data))
+	}
+}
+
+func (suite *DurableTestSuite) TestDurableFailedFlowRedelivered() {
+	t := suite.T()
+
+	var calls int32
+	trg := startTestProtoTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+		"maxDeliver":      3,
+	}, &testTriggerHandler{
+		settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil, errors.New("flow failed")
+			}
+			return map[string]interface{}{"data": triggerData.(*Output).ProtobufRequestMap}, nil
+		},
+	})
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// The failed flow is not replied, the caller receives the reply of the redelivered request
+	resp := &wrapperspb.StringValue{}
+	err = Call(&wrapperspb.StringValue{Value: "retry"}, resp, nc, "test.EchoService.Echo", "protobuf", 5*time.Second)
+	assert.Nil(t, err, "Call error")
+	assert.Equal(t, "retry", resp.Value)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	js, err := nc.JetStream()
+	assert.Nil(t, err, "Cannot get JetStream context")
+	assert.Eventually(t, func() bool {
+		info, err := js.ConsumerInfo(defaultStreamName, durableConsumerName(defaultDurableName, "test.EchoService.>"))
+		return err == nil && info.NumAckPending == 0 && info.AckFloor.Stream == 1
+	}, 5*time.Second, 50*time.Millisecond, "Request should be acknowledged")
+}
+
+func (suite *DurableTestSuite) TestDurableFailedFlowLastDelivery() {
+	t := suite.T()
+
+	var calls int32
+	trg := startTestProtoTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+		"maxDeliver":      2,
+	}, &testTriggerHandler{
+		settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errors.New("flow failed")
+		},
+	})
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// The caller is replied the error of the last delivery
+	err = Call(&wrapperspb.StringValue{Value: "fail"}, &wrapperspb.StringValue{}, nc, "test.EchoService.Echo", "protobuf", 5*time.Second)
+	if assert.IsType(t, &nrpc.Error{}, err) {
+		assert.Equal(t, "flow failed", err.(*nrpc.Error).Message)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func (suite *DurableTestSuite) TestDurableRequestWithoutReplySubject() {
+	t := suite.T()
+
+	var calls int32
+	trg := startTestTrigger(t, map[string]interface{}{
+		"natsClusterUrls": durableTestURL,
+		"enableStreaming": true,
+	}, &testTriggerHandler{
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return map[string]interface{}{"code": 0}, nil
+		},
+	})
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect(durableTestURL)
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	err = nc.Publish("EchoService.Echo", []byte(`{"message":"lost"}`))
+	assert.Nil(t, err, "Cannot publish request")
+
+	// The request is terminated without running the flow
+	assert.Eventually(t, func() bool {
+		info := suite.consumerInfo(nc)
+		return info.Delivered.Consumer == 1 && info.NumAckPending == 0
+	}, 5*time.Second, 50*time.Millisecond, "Request should be terminated")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestDurableTestSuite(t *testing.T) {
+	suite.Run(t, new(DurableTestSuite))
+}
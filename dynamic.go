@@ -0,0 +1,175 @@
+package nrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	nats "github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+// dynamicService is a service of the proto file loaded when the trigger is initialized, its
+// messages are built at runtime from the proto descriptors
+type dynamicService struct {
+	serviceInfo *ServiceInfo
+	methods     []Method
+}
+
+// ServiceInfo returns the names of the service and of its proto
+func (s *dynamicService) ServiceInfo() *ServiceInfo {
+	return s.serviceInfo
+}
+
+// RunRegisterServerService serves the service methods with the trigger handlers
+func (s *dynamicService) RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler) error {
+	return h.Serve(t, s.serviceInfo, s.methods...)
+}
+
+// protoFilePicker is the protoFile setting set with a file picker
+type protoFilePicker struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// loadDynamicServices parses the proto files of the trigger settings and returns the services they
+// declare, named and subscribed as the generated support files would
+func loadDynamicServices(settings *Settings) ([]ServerService, error) {
+	protos := settings.protos()
+	if len(protos) == 0 {
+		return nil, errors.New("Invalid protoFile setting: required to load the proto dynamically")
+	}
+
+	var services []ServerService
+	for _, proto := range protos {
+		protoServices, err := loadProtoServices(proto)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, protoServices...)
+	}
+	return services, nil
+}
+
+// loadProtoServices parses a proto file and returns the services it declares
+func loadProtoServices(protoSettings ProtoSettings) ([]ServerService, error) {
+	files, err := parseProtoFile(protoSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := protodesc.NewFiles(desc.ToFileDescriptorSet(files...))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load proto descriptors: %v", err)
+	}
+
+	var services []ServerService
+	for _, file := range files {
+		protoName := strings.Split(filepath.Base(file.GetName()), ".")[0]
+		for _, service := range file.GetServices() {
+			dynamic := &dynamicService{
+				serviceInfo: &ServiceInfo{
+					ServiceName:    schema.CamelCase(service.GetName()),
+					ProtoName:      protoName,
+					PackageSubject: schema.PackageSubject(file),
+					ServiceSubject: schema.ServiceSubject(service),
+					PackageParams:  schema.PackageSubjectParams(file),
+					ServiceParams:  schema.ServiceSubjectParams(service),
+				},
+			}
+
+			for _, method := range service.GetMethods() {
+				newRequest, err := newDynamicMessage(registry, method.GetInputType().GetFullyQualifiedName())
+				if err != nil {
+					return nil, err
+				}
+				newReply, err := newDynamicMessage(registry, method.GetOutputType().GetFullyQualifiedName())
+				if err != nil {
+					return nil, err
+				}
+
+				dynamic.methods = append(dynamic.methods, Method{
+					Name:          schema.CamelCase(method.GetName()),
+					Subject:       schema.MethodSubject(method),
+					NewRequest:    newRequest,
+					NewReply:      newReply,
+					SubjectParams: schema.MethodSubjectParams(method),
+					ServerStream:  method.IsServerStreaming() || schema.StreamedReply(method),
+					ClientStream:  method.IsClientStreaming(),
+				})
+			}
+			services = append(services, dynamic)
+		}
+	}
+
+	if len(services) == 0 {
+		return nil, fmt.Errorf("Invalid protoFile setting: no service declared by %s", protoSettings.name())
+	}
+	return services, nil
+}
+
+// newDynamicMessage returns a constructor of the named message
+func newDynamicMessage(registry *protoregistry.Files, name string) (func() proto.Message, error) {
+	descriptor, err := registry.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find message %s: %v", name, err)
+	}
+	message, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("Cannot find message %s: not a message", name)
+	}
+
+	return func() proto.Message {
+		return dynamicpb.NewMessage(message)
+	}, nil
+}
+
+// parseProtoFile parses a protoFile setting, either the path of a .proto file or of a binary
+// FileDescriptorSet, or the file picker object with its content
+func parseProtoFile(settings ProtoSettings) ([]*desc.FileDescriptor, error) {
+	protoFile := strings.TrimSpace(settings.ProtoFile)
+	if protoFile == "" {
+		return nil, errors.New("Invalid protoFile setting: required to load the proto dynamically")
+	}
+
+	// Objects are coerced to their JSON string
+	if !strings.HasPrefix(protoFile, "{") {
+		if !schema.IsDescriptorSet(protoFile) {
+			return schema.ParseFiles([]string{filepath.Dir(protoFile)}, filepath.Base(protoFile))
+		}
+
+		content, err := ioutil.ReadFile(protoFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid protoFile setting: %v", err)
+		}
+		return schema.ParseDescriptorSet(content)
+	}
+
+	picker := &protoFilePicker{}
+	if err := json.Unmarshal([]byte(protoFile), picker); err != nil {
+		return nil, fmt.Errorf("Invalid protoFile setting: %v", err)
+	}
+	content, err := schema.FileContent(picker.Content)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid protoFile setting: %v", err)
+	}
+
+	fileName := picker.Filename
+	if fileName == "" {
+		fileName = strings.Split(settings.ProtoName, ".")[0] + ".proto"
+	}
+	if schema.IsDescriptorSet(fileName) {
+		return schema.ParseDescriptorSet(content)
+	}
+	return schema.ParseContent(fileName, content)
+}
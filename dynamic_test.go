@@ -0,0 +1,284 @@
+package nrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/codelity-co/flogo-nrpc-trigger/schema"
+)
+
+const testDynamicProto = `syntax = "proto3";
+
+package dyn;
+
+import "nrpc.proto";
+
+option (nrpc.packageSubject) = "dyn";
+
+service echo_service {
+  rpc echo(EchoRequest) returns (EchoReply);
+  rpc split(EchoRequest) returns (stream EchoReply);
+}
+
+message EchoRequest {
+  string value = 1;
+  int64 count = 2;
+}
+
+message EchoReply {
+  string value = 1;
+}
+`
+
+type DynamicTestSuite struct {
+	suite.Suite
+}
+
+// writeTestProto writes the dynamic test proto to a temp dir and returns its path
+func (suite *DynamicTestSuite) writeTestProto() string {
+	t := suite.T()
+
+	dir, err := ioutil.TempDir("", "flogo-nrpc-dynamic")
+	assert.Nil(t, err, "Cannot create temp dir")
+
+	protoFile := filepath.Join(dir, "dyn.proto")
+	err = ioutil.WriteFile(protoFile, []byte(testDynamicProto), 0644)
+	assert.Nil(t, err, "Cannot write proto file")
+	return protoFile
+}
+
+// testDescriptorSet returns the dynamic test proto as a binary FileDescriptorSet, without its
+// imports
+func (suite *DynamicTestSuite) testDescriptorSet() []byte {
+	t := suite.T()
+
+	files, err := schema.ParseContent("dyn.proto", []byte(testDynamicProto))
+	assert.Nil(t, err, "Cannot parse proto")
+	data, err := proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{files[0].AsFileDescriptorProto()}})
+	assert.Nil(t, err, "Cannot marshal descriptor set")
+	return data
+}
+
+func (suite *DynamicTestSuite) TestServeDynamicProto() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	protoFile := suite.writeTestProto()
+	defer os.RemoveAll(filepath.Dir(protoFile))
+
+	descriptorSet := suite.testDescriptorSet()
+	descriptorSetFile := filepath.Join(filepath.Dir(protoFile), "dyn.protoset")
+	err := ioutil.WriteFile(descriptorSetFile, descriptorSet, 0644)
+	assert.Nil(t, err, "Cannot write descriptor set")
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for name, protoFileSetting := range map[string]interface{}{
+		"path": protoFile,
+		"file picker": map[string]interface{}{
+			"filename": "dyn.proto",
+			"content":  "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString([]byte(testDynamicProto)),
+		},
+	} {
+		trg := startTestTriggerWithSettings(t, map[string]interface{}{"dynamicProto": true, "protoFile": protoFileSetting},
+			newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"}, ""),
+			&testTriggerHandler{
+				settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Split"},
+				handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+					out := triggerData.(*Output)
+					assert.Equal(t, int64(0), out.ProtobufRequestMap["count"], "Messages are decoded with the proto types")
+
+					var items []interface{}
+					for _, value := range strings.Split(out.ProtobufRequestMap["value"].(string), ",") {
+						items = append(items, map[string]interface{}{"value": value})
+					}
+					return map[string]interface{}{"data": items}, nil
+				},
+			},
+		)
+
+		resp := &wrapperspb.StringValue{}
+		err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "dyn.echo_service.echo", "protobuf", time.Second)
+		assert.Nil(t, err, "Call error with %s setting", name)
+		assert.Equal(t, "hello", resp.Value)
+
+		sub, err := nrpc.StreamCall(context.Background(), nc, "dyn.echo_service.split", &wrapperspb.StringValue{Value: "a,b"}, "protobuf", time.Second)
+		assert.Nil(t, err, "StreamCall error with %s setting", name)
+		var values []string
+		for err == nil {
+			resp := &wrapperspb.StringValue{}
+			if err = sub.Next(resp); err == nil {
+				values = append(values, resp.Value)
+			}
+		}
+		assert.Equal(t, nrpc.ErrEOS, err)
+		assert.Equal(t, []string{"a", "b"}, values)
+
+		assert.Nil(t, trg.Stop(), "Stop error")
+	}
+}
+
+func (suite *DynamicTestSuite) TestServeDynamicProtos() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	protoFile := suite.writeTestProto()
+	defer os.RemoveAll(filepath.Dir(protoFile))
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	trg := startTestTriggerWithSettings(t, map[string]interface{}{
+		"dynamicProto": true,
+		"protoFile":    protoFile,
+		"protos": []interface{}{
+			map[string]interface{}{
+				"protoName": "upper",
+				"protoFile": map[string]interface{}{"content": `syntax = "proto3";
+package upper;
+service UpperService {
+  rpc Upper(UpperRequest) returns (UpperRequest);
+}
+message UpperRequest {
+  string value = 1;
+}
+`},
+			},
+		},
+	},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService"}, ""),
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "UpperService"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				out := triggerData.(*Output)
+				return map[string]interface{}{"data": map[string]interface{}{"value": strings.ToUpper(out.ProtobufRequestMap["value"].(string))}}, nil
+			},
+		},
+	)
+	defer trg.Stop()
+
+	for subject, expected := range map[string]string{"dyn.echo_service.echo": "hello", "upper.UpperService.Upper": "HELLO"} {
+		resp := &wrapperspb.StringValue{}
+		err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, subject, "protobuf", time.Second)
+		assert.Nil(t, err, "Call error for %s", subject)
+		assert.Equal(t, expected, resp.Value)
+	}
+}
+
+func (suite *DynamicTestSuite) TestServeDynamicSubjectParams() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	outputs := make(chan *Output, 1)
+	trg := startTestTriggerWithSettings(t, map[string]interface{}{
+		"dynamicProto": true,
+		"protoFile": map[string]interface{}{"filename": "user.proto", "content": `syntax = "proto3";
+package user;
+import "nrpc.proto";
+option (nrpc.packageSubject) = "acme";
+option (nrpc.packageSubjectParams) = "tenant";
+service UserService {
+  option (nrpc.serviceSubjectParams) = "region";
+  rpc Get(GetRequest) returns (GetRequest) {
+    option (nrpc.methodSubjectParams) = "shard";
+  }
+}
+message GetRequest {
+  string value = 1;
+}
+`},
+	},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "UserService", "methodName": "Get"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				out := triggerData.(*Output)
+				outputs <- out
+				return map[string]interface{}{"data": map[string]interface{}{"value": out.Params["tenant"] + "/" + out.Params["region"] + "/" + out.Params["shard"]}}, nil
+			},
+		},
+	)
+	defer trg.Stop()
+
+	resp := &wrapperspb.StringValue{}
+	err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "acme.t1.UserService.eu.Get.s1", "protobuf", time.Second)
+	if assert.Nil(t, err, "Call error") {
+		assert.Equal(t, "t1/eu/s1", resp.Value)
+
+		out := <-outputs
+		assert.Equal(t, map[string]string{"tenant": "t1", "region": "eu", "shard": "s1"}, out.Params)
+		assert.Equal(t, map[string]interface{}{"tenant": "t1"}, out.Metadata["packageParams"])
+		assert.Equal(t, map[string]interface{}{"region": "eu"}, out.Metadata["serviceParams"])
+		assert.Equal(t, map[string]interface{}{"shard": "s1"}, out.Metadata["methodParams"])
+		assert.Equal(t, "acme.t1.UserService.eu.Get.s1", out.Metadata["subject"])
+	}
+
+	// The method parameter is missing
+	err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "acme.t1.UserService.eu.Get", "protobuf", time.Second)
+	if assert.NotNil(t, err, "Expected an error without the method parameter") {
+		assert.Contains(t, err.Error(), "Invalid subject tail length")
+	}
+}
+
+func (suite *DynamicTestSuite) TestDynamicProtoErrors() {
+	t := suite.T()
+
+	protoFile := suite.writeTestProto()
+	defer os.RemoveAll(filepath.Dir(protoFile))
+
+	for name, protoFileSetting := range map[string]interface{}{
+		"missing":                  "",
+		"not found":                filepath.Join(filepath.Dir(protoFile), "missing.proto"),
+		"invalid":                  map[string]interface{}{"filename": "dyn.proto", "content": "syntax = \"proto3\"; message {"},
+		"no services":              map[string]interface{}{"filename": "dyn.proto", "content": "syntax = \"proto3\"; message Empty {}"},
+		"descriptor set not found": filepath.Join(filepath.Dir(protoFile), "missing.pb"),
+		"invalid descriptor set":   map[string]interface{}{"filename": "dyn.pb", "content": "not a descriptor set"},
+	} {
+		f := trigger.GetFactory(support.GetRef(&Trigger{}))
+		trg, err := f.New(&trigger.Config{
+			Id: "flogo-nrpc-trigger",
+			Settings: map[string]interface{}{
+				"natsClusterUrls": "nats://localhost:4222",
+				"dynamicProto":    true,
+				"protoFile":       protoFileSetting,
+			},
+		})
+		assert.Nil(t, err, "Cannot create trigger")
+
+		err = trg.Initialize(&testInitContext{})
+		assert.NotNil(t, err, "Expected an Initialize error for %s proto file", name)
+	}
+}
+
+func TestDynamicTestSuite(t *testing.T) {
+	suite.Run(t, new(DynamicTestSuite))
+}
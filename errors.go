@@ -0,0 +1,118 @@
+package nrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/project-flogo/core/activity"
+
+	nrpc "github.com/nats-rpc/nrpc"
+)
+
+// ReplyError is an error replied by a flow to the nRPC client, either with a reply code which is
+// not a success code or by failing with an activity error
+type ReplyError struct {
+	Type    nrpc.Error_Type
+	Message string
+	Details interface{}
+}
+
+// replyErrorDetails is the message of the nrpc errors replied with details
+type replyErrorDetails struct {
+	Message string      `json:"message"`
+	Details interface{} `json:"details"`
+}
+
+// Error implements error.Error
+func (e *ReplyError) Error() string {
+	return (&nrpc.Error{Type: e.Type, Message: e.Message}).Error()
+}
+
+// nrpcError returns the nrpc error replied to the client, the message and the details are sent as
+// a JSON object when there are details
+func (e *ReplyError) nrpcError() *nrpc.Error {
+	message := e.Message
+	if e.Details != nil {
+		if data, err := json.Marshal(&replyErrorDetails{Message: e.Message, Details: e.Details}); err == nil {
+			message = string(data)
+		}
+	}
+	return &nrpc.Error{Type: e.Type, Message: message}
+}
+
+// ParseReplyError returns the error replied by the nRPC server with its details. False is returned
+// when err is not an nrpc error, e.g. a timeout or another transport failure.
+func ParseReplyError(err error) (*ReplyError, bool) {
+	var nrpcErr *nrpc.Error
+	if !errors.As(err, &nrpcErr) {
+		return nil, false
+	}
+
+	replyErr := &ReplyError{Type: nrpcErr.Type, Message: nrpcErr.Message}
+	details := &replyErrorDetails{}
+	if strings.HasPrefix(nrpcErr.Message, "{") && json.Unmarshal([]byte(nrpcErr.Message), details) == nil {
+		replyErr.Message = details.Message
+		replyErr.Details = details.Details
+	}
+	return replyErr, true
+}
+
+// replyErrorType returns the nrpc error type of a flow reply code, codes follow the HTTP status
+// codes. False is returned for the success codes, 0 and 2xx.
+func replyErrorType(code int) (nrpc.Error_Type, bool) {
+	switch {
+	case code == 0 || (code >= 200 && code < 300):
+		return 0, false
+	case code == 429 || code == 503:
+		return nrpc.Error_SERVERTOOBUSY, true
+	case code >= 400 && code < 500:
+		return nrpc.Error_CLIENT, true
+	default:
+		return nrpc.Error_SERVER, true
+	}
+}
+
+// replyError returns the error replied for the flow reply, nil when its code is a success code
+func (r *Reply) replyError() *nrpc.Error {
+	errType, ok := replyErrorType(r.Code)
+	if !ok {
+		return nil
+	}
+
+	message := r.Message
+	if message == "" {
+		message = fmt.Sprintf("flow replied with code %d", r.Code)
+	}
+	return (&ReplyError{Type: errType, Message: message, Details: r.Details}).nrpcError()
+}
+
+// flowError returns the nrpc error replied for a flow failure. The code of an activity error is
+// either an nrpc error type name or a reply code, retriable activity errors are server too busy
+// errors by default. Other errors are server errors.
+func flowError(err error) *nrpc.Error {
+	var nrpcErr *nrpc.Error
+	if errors.As(err, &nrpcErr) {
+		return nrpcErr
+	}
+
+	var activityErr *activity.Error
+	if !errors.As(err, &activityErr) {
+		return &nrpc.Error{Type: nrpc.Error_SERVER, Message: err.Error()}
+	}
+
+	replyErr := &ReplyError{Type: nrpc.Error_SERVER, Message: activityErr.Error(), Details: activityErr.Data()}
+	if activityErr.Retriable() {
+		replyErr.Type = nrpc.Error_SERVERTOOBUSY
+	}
+	if errType, ok := nrpc.Error_Type_value[strings.ToUpper(activityErr.Code())]; ok {
+		replyErr.Type = nrpc.Error_Type(errType)
+	} else if code, err := strconv.Atoi(activityErr.Code()); err == nil {
+		if errType, ok := replyErrorType(code); ok {
+			replyErr.Type = errType
+		}
+	}
+	return replyErr.nrpcError()
+}
@@ -0,0 +1,69 @@
+package nrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+)
+
+type ErrorsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ErrorsTestSuite) TestReplyError() {
+	t := suite.T()
+
+	for code, expected := range map[int]*nrpc.Error{
+		0:   nil,
+		200: nil,
+		204: nil,
+		400: {Type: nrpc.Error_CLIENT, Message: "flow replied with code 400"},
+		404: {Type: nrpc.Error_CLIENT, Message: "flow replied with code 404"},
+		429: {Type: nrpc.Error_SERVERTOOBUSY, Message: "flow replied with code 429"},
+		503: {Type: nrpc.Error_SERVERTOOBUSY, Message: "flow replied with code 503"},
+		500: {Type: nrpc.Error_SERVER, Message: "flow replied with code 500"},
+		1:   {Type: nrpc.Error_SERVER, Message: "flow replied with code 1"},
+	} {
+		assert.Equal(t, expected, (&Reply{Code: code}).replyError(), "Reply error of code %d", code)
+	}
+
+	replyErr := (&Reply{Code: 409, Message: "conflict", Details: []interface{}{"a"}}).replyError()
+	assert.Equal(t, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: `{"message":"conflict","details":["a"]}`}, replyErr)
+}
+
+func (suite *ErrorsTestSuite) TestFlowError() {
+	t := suite.T()
+
+	for name, test := range map[string]struct {
+		err      error
+		expected *ReplyError
+	}{
+		"plain":         {errors.New("failed"), &ReplyError{Type: nrpc.Error_SERVER, Message: "failed"}},
+		"nrpc":          {&nrpc.Error{Type: nrpc.Error_CLIENT, Message: "bad"}, &ReplyError{Type: nrpc.Error_CLIENT, Message: "bad"}},
+		"type code":     {activity.NewError("bad", "client", nil), &ReplyError{Type: nrpc.Error_CLIENT, Message: "bad"}},
+		"reply code":    {activity.NewError("gone", "410", "user"), &ReplyError{Type: nrpc.Error_CLIENT, Message: "gone", Details: "user"}},
+		"success code":  {activity.NewError("failed", "200", nil), &ReplyError{Type: nrpc.Error_SERVER, Message: "failed"}},
+		"retriable":     {activity.NewRetriableError("later", "", nil), &ReplyError{Type: nrpc.Error_SERVERTOOBUSY, Message: "later"}},
+		"unknown code":  {activity.NewError("failed", "E42", nil), &ReplyError{Type: nrpc.Error_SERVER, Message: "failed"}},
+		"with details":  {activity.NewError("failed", "", map[string]interface{}{"a": 1.0}), &ReplyError{Type: nrpc.Error_SERVER, Message: "failed", Details: map[string]interface{}{"a": 1.0}}},
+		"not a details": {&nrpc.Error{Type: nrpc.Error_SERVER, Message: "{not json"}, &ReplyError{Type: nrpc.Error_SERVER, Message: "{not json"}},
+	} {
+		replyErr, ok := ParseReplyError(flowError(test.err))
+		if assert.True(t, ok, "Expected a reply error for %s", name) {
+			assert.Equal(t, test.expected, replyErr, "Reply error for %s", name)
+		}
+	}
+
+	_, ok := ParseReplyError(nats.ErrTimeout)
+	assert.False(t, ok, "Transport failures are not reply errors")
+}
+
+func TestErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorsTestSuite))
+}
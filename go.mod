@@ -4,13 +4,17 @@ go 1.13
 
 require (
 	github.com/golang/protobuf v1.4.3
+	github.com/jhump/protoreflect v1.9.0
 	github.com/nats-io/gnatsd v1.4.1
+	github.com/nats-io/jwt v1.2.2
 	github.com/nats-io/nats-server v1.4.1
-	github.com/nats-io/nats-server/v2 v2.1.9
-	github.com/nats-io/nats.go v1.10.0
+	github.com/nats-io/nats-server/v2 v2.2.6
+	github.com/nats-io/nats.go v1.11.0
+	github.com/nats-io/nkeys v0.3.0
+	github.com/nats-io/nuid v1.0.1
 	github.com/nats-io/stan.go v0.7.0 // indirect
 	github.com/nats-rpc/nrpc v0.0.0-20201006200202-510bc58f2c5d
 	github.com/project-flogo/core v1.1.0
 	github.com/stretchr/testify v1.5.1
-	google.golang.org/protobuf v1.23.0
+	google.golang.org/protobuf v1.25.1-0.20200805231151-a709e31e5d12
 )
@@ -1,31 +1,191 @@
 package nrpc
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"github.com/project-flogo/core/data/coerce"
 )
 
 // Settings struct
 type Settings struct {
-	NatsClusterUrls          string `md:"natsClusterUrls,required"`
-	NatsConnName             string `md:"natsConnName"`
-	NatsUserName             string `md:"natsUserName"`
-	NatsUserPassword         string `md:"natsUserPassword"`
-	NatsToken                string `md:"natsToken"`
-	NatsNkeySeedfile         string `md:"natsNkeySeedfile"`
-	NatsCredentialFile       string `md:"natsCredentialFile"`
-	AutoReconnect            bool   `md:"autoReconnect"`
-	MaxReconnects            int    `md:"maxReconnects"`
-	EnableRandomReconnection bool   `md:"enableRandomReconnection"`
-	ReconnectWait            int    `md:"reconnectWait"`
-	ReconnectBufferSize      int    `md:"reconnectBufferSize"`
-	SkipVerify               bool   `md:"skipVerify"`
-	CaFile                   string `md:"caFile"`
-	CertFile                 string `md:"certFile"`
-	KeyFile                  string `md:"keyFile"`
-	EnableStreaming          bool   `md:"enableStreaming"`
-	StanClusterID            string `md:"stanClusterID"`
-	ProtoName                string `md:"protoName"`
-	ProtoFile                string `md:"protoFile"`
+	NatsClusterUrls          string          `md:"natsClusterUrls,required"`
+	NatsConnName             string          `md:"natsConnName"`
+	NatsConnPoolSize         int             `md:"natsConnPoolSize"`
+	NatsUserName             string          `md:"natsUserName"`
+	NatsUserPassword         string          `md:"natsUserPassword"`
+	NatsToken                string          `md:"natsToken"`
+	NatsNkeySeedfile         string          `md:"natsNkeySeedfile"`
+	NatsCredentialFile       string          `md:"natsCredentialFile"`
+	AutoReconnect            bool            `md:"autoReconnect"`
+	MaxReconnects            int             `md:"maxReconnects"`
+	EnableRandomReconnection bool            `md:"enableRandomReconnection"`
+	ReconnectWait            int             `md:"reconnectWait"`
+	ReconnectBufferSize      int             `md:"reconnectBufferSize"`
+	SkipVerify               bool            `md:"skipVerify"`
+	CaFile                   string          `md:"caFile"`
+	CertFile                 string          `md:"certFile"`
+	KeyFile                  string          `md:"keyFile"`
+	TLSUseSystemRoots        bool            `md:"tlsUseSystemRoots"`
+	TLSMinVersion            string          `md:"tlsMinVersion"`
+	TLSCipherSuites          string          `md:"tlsCipherSuites"`
+	TLSServerName            string          `md:"tlsServerName"`
+	CredentialReloadInterval int             `md:"credentialReloadInterval"`
+	EnableStreaming          bool            `md:"enableStreaming"`
+	StanClusterID            string          `md:"stanClusterID"`
+	StreamName               string          `md:"streamName"`
+	DurableName              string          `md:"durableName"`
+	AckWait                  int             `md:"ackWait"`
+	MaxDeliver               int             `md:"maxDeliver"`
+	ProtoName                string          `md:"protoName"`
+	ProtoFile                string          `md:"protoFile"`
+	Protos                   []ProtoSettings `md:"protos"`
+	DynamicProto             bool            `md:"dynamicProto"`
+	WorkerPoolSize           int             `md:"workerPoolSize"`
+	WorkerQueueSize          int             `md:"workerQueueSize"`
+	ShutdownTimeout          int             `md:"shutdownTimeout"`
+	QueueGroup               string          `md:"queueGroup"`
+	SubjectPrefix            string          `md:"subjectPrefix"`
+}
+
+// ProtoSettings is a proto whose services are served by the trigger
+type ProtoSettings struct {
+	ProtoName string `md:"protoName"`
+	ProtoFile string `md:"protoFile"`
+}
+
+// name returns the proto name, the base name of the proto file path when protoName is not set
+func (p ProtoSettings) name() string {
+	if p.ProtoName != "" || strings.HasPrefix(strings.TrimSpace(p.ProtoFile), "{") {
+		return strings.Split(p.ProtoName, ".")[0]
+	}
+	return strings.Split(filepath.Base(p.ProtoFile), ".")[0]
+}
+
+const (
+	defaultNatsConnPoolSize = 1
+	defaultWorkerPoolSize   = 10
+	defaultWorkerQueueSize  = 100
+	defaultShutdownTimeout  = 30
+
+	defaultCredentialReloadInterval = 30
+
+	defaultStreamName  = "NRPC"
+	defaultDurableName = "flogo-nrpc-trigger"
+	defaultAckWait     = 30
+	defaultMaxDeliver  = 5
+)
+
+// natsConnPoolSize returns the number of NATS connections of the trigger, falling back to the default when unset
+func (s *Settings) natsConnPoolSize() int {
+	if s.NatsConnPoolSize <= 0 {
+		return defaultNatsConnPoolSize
+	}
+	return s.NatsConnPoolSize
+}
+
+// workerPoolSize returns the number of workers per handler, falling back to the default when unset
+func (s *Settings) workerPoolSize() int {
+	if s.WorkerPoolSize <= 0 {
+		return defaultWorkerPoolSize
+	}
+	return s.WorkerPoolSize
+}
+
+// workerQueueSize returns the handler queue depth, falling back to the default when unset
+func (s *Settings) workerQueueSize() int {
+	if s.WorkerQueueSize <= 0 {
+		return defaultWorkerQueueSize
+	}
+	return s.WorkerQueueSize
+}
+
+// shutdownTimeout returns how long Stop waits for running requests, falling back to the default when unset
+func (s *Settings) shutdownTimeout() time.Duration {
+	if s.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout * time.Second
+	}
+	return time.Duration(s.ShutdownTimeout) * time.Second
+}
+
+// queueGroup returns the NATS queue group the subscriptions of the service join, so that the
+// instances of an app share its calls. It is derived from the proto and service names when unset.
+func (s *Settings) queueGroup(service *ServiceInfo) string {
+	if s.QueueGroup != "" {
+		return s.QueueGroup
+	}
+	return service.ProtoName + "." + service.ServiceName
+}
+
+// subjectPrefix returns the subject tokens namespacing the nRPC subjects, without surrounding dots.
+// The prefix cannot hold wildcards nor empty tokens.
+func (s *Settings) subjectPrefix() (string, error) {
+	prefix := strings.Trim(strings.TrimSpace(s.SubjectPrefix), ".")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, token := range strings.Split(prefix, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return "", fmt.Errorf("Invalid subjectPrefix setting [%s], expecting dot-separated subject tokens without wildcards", s.SubjectPrefix)
+		}
+	}
+	return prefix, nil
+}
+
+// credentialReloadInterval returns how often the certificate and credential files are checked for
+// changes, falling back to the default when unset. Zero is returned when a negative value disables reloading.
+func (s *Settings) credentialReloadInterval() time.Duration {
+	if s.CredentialReloadInterval < 0 {
+		return 0
+	}
+	if s.CredentialReloadInterval == 0 {
+		return defaultCredentialReloadInterval * time.Second
+	}
+	return time.Duration(s.CredentialReloadInterval) * time.Second
+}
+
+// streamName returns the JetStream stream receiving the nRPC requests in durable mode, falling back to the default when unset
+func (s *Settings) streamName() string {
+	if s.StreamName == "" {
+		return defaultStreamName
+	}
+	return s.StreamName
+}
+
+// durableName returns the prefix of the JetStream durable consumer names, falling back to the default when unset
+func (s *Settings) durableName() string {
+	if s.DurableName == "" {
+		return defaultDurableName
+	}
+	return s.DurableName
+}
+
+// ackWait returns how long JetStream waits for the acknowledgement of a request before redelivering it,
+// falling back to the default when unset
+func (s *Settings) ackWait() time.Duration {
+	if s.AckWait <= 0 {
+		return defaultAckWait * time.Second
+	}
+	return time.Duration(s.AckWait) * time.Second
+}
+
+// maxDeliver returns how many times JetStream delivers a request, falling back to the default when unset
+func (s *Settings) maxDeliver() int {
+	if s.MaxDeliver <= 0 {
+		return defaultMaxDeliver
+	}
+	return s.MaxDeliver
+}
+
+// protos returns the protos served by the trigger, protoName and protoFile first followed by the protos list
+func (s *Settings) protos() []ProtoSettings {
+	var protos []ProtoSettings
+	if s.ProtoName != "" || s.ProtoFile != "" {
+		protos = append(protos, ProtoSettings{ProtoName: s.ProtoName, ProtoFile: s.ProtoFile})
+	}
+	return append(protos, s.Protos...)
 }
 
 // FromMap method of Settings
@@ -44,6 +204,11 @@ func (s *Settings) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	s.NatsConnPoolSize, err = coerce.ToInt(values["natsConnPoolSize"])
+	if err != nil {
+		return err
+	}
+
 	s.NatsUserName, err = coerce.ToString(values["natsUserName"])
 	if err != nil {
 		return err
@@ -114,6 +279,31 @@ func (s *Settings) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	s.TLSUseSystemRoots, err = coerce.ToBool(values["tlsUseSystemRoots"])
+	if err != nil {
+		return err
+	}
+
+	s.TLSMinVersion, err = coerce.ToString(values["tlsMinVersion"])
+	if err != nil {
+		return err
+	}
+
+	s.TLSCipherSuites, err = coerce.ToString(values["tlsCipherSuites"])
+	if err != nil {
+		return err
+	}
+
+	s.TLSServerName, err = coerce.ToString(values["tlsServerName"])
+	if err != nil {
+		return err
+	}
+
+	s.CredentialReloadInterval, err = coerce.ToInt(values["credentialReloadInterval"])
+	if err != nil {
+		return err
+	}
+
 	s.EnableStreaming, err = coerce.ToBool(values["enableStreaming"])
 	if err != nil {
 		return err
@@ -124,6 +314,26 @@ func (s *Settings) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	s.StreamName, err = coerce.ToString(values["streamName"])
+	if err != nil {
+		return err
+	}
+
+	s.DurableName, err = coerce.ToString(values["durableName"])
+	if err != nil {
+		return err
+	}
+
+	s.AckWait, err = coerce.ToInt(values["ackWait"])
+	if err != nil {
+		return err
+	}
+
+	s.MaxDeliver, err = coerce.ToInt(values["maxDeliver"])
+	if err != nil {
+		return err
+	}
+
 	s.ProtoName, err = coerce.ToString(values["protoName"])
 	if err != nil {
 		return err
@@ -133,6 +343,41 @@ func (s *Settings) FromMap(values map[string]interface{}) error {
 	if err != nil {
 		return err
 	}
+
+	s.Protos, err = toProtoSettings(values["protos"])
+	if err != nil {
+		return err
+	}
+
+	s.DynamicProto, err = coerce.ToBool(values["dynamicProto"])
+	if err != nil {
+		return err
+	}
+
+	s.WorkerPoolSize, err = coerce.ToInt(values["workerPoolSize"])
+	if err != nil {
+		return err
+	}
+
+	s.WorkerQueueSize, err = coerce.ToInt(values["workerQueueSize"])
+	if err != nil {
+		return err
+	}
+
+	s.ShutdownTimeout, err = coerce.ToInt(values["shutdownTimeout"])
+	if err != nil {
+		return err
+	}
+
+	s.QueueGroup, err = coerce.ToString(values["queueGroup"])
+	if err != nil {
+		return err
+	}
+
+	s.SubjectPrefix, err = coerce.ToString(values["subjectPrefix"])
+	if err != nil {
+		return err
+	}
 	return nil
 
 }
@@ -143,6 +388,7 @@ func (s *Settings) ToMap() map[string]interface{} {
 	return map[string]interface{}{
 		"natsClusterUrls":          s.NatsClusterUrls,
 		"natsConnName":             s.NatsConnName,
+		"natsConnPoolSize":         s.NatsConnPoolSize,
 		"natsUserName":             s.NatsUserName,
 		"natsUserPassword":         s.NatsUserPassword,
 		"natsToken":                s.NatsToken,
@@ -157,17 +403,182 @@ func (s *Settings) ToMap() map[string]interface{} {
 		"caFile":                   s.CaFile,
 		"certFile":                 s.CertFile,
 		"keyFile":                  s.KeyFile,
+		"tlsUseSystemRoots":        s.TLSUseSystemRoots,
+		"tlsMinVersion":            s.TLSMinVersion,
+		"tlsCipherSuites":          s.TLSCipherSuites,
+		"tlsServerName":            s.TLSServerName,
+		"credentialReloadInterval": s.CredentialReloadInterval,
 		"enableStreaming":          s.EnableStreaming,
 		"stanClusterID":            s.StanClusterID,
+		"streamName":               s.StreamName,
+		"durableName":              s.DurableName,
+		"ackWait":                  s.AckWait,
+		"maxDeliver":               s.MaxDeliver,
 		"protoName":                s.ProtoName,
 		"protoFile":                s.ProtoFile,
+		"protos":                   s.Protos,
+		"dynamicProto":             s.DynamicProto,
+		"workerPoolSize":           s.WorkerPoolSize,
+		"workerQueueSize":          s.WorkerQueueSize,
+		"shutdownTimeout":          s.ShutdownTimeout,
+		"queueGroup":               s.QueueGroup,
+		"subjectPrefix":            s.SubjectPrefix,
+	}
+
+}
+
+// toProtoSettings coerces the protos setting, a list of objects with the protoName and protoFile
+// of each proto
+func toProtoSettings(value interface{}) ([]ProtoSettings, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case []ProtoSettings:
+		return value, nil
 	}
+	items, err := coerce.ToArray(value)
+	if err != nil {
+		return nil, err
+	}
+
+	protos := make([]ProtoSettings, 0, len(items))
+	for i, item := range items {
+		values, err := coerce.ToObject(item)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid protos setting: item %d: %v", i, err)
+		}
+
+		proto := ProtoSettings{}
+		if proto.ProtoName, err = coerce.ToString(values["protoName"]); err != nil {
+			return nil, fmt.Errorf("Invalid protos setting: item %d: %v", i, err)
+		}
+		if proto.ProtoFile, err = coerce.ToString(values["protoFile"]); err != nil {
+			return nil, fmt.Errorf("Invalid protos setting: item %d: %v", i, err)
+		}
+		if proto.ProtoName == "" && proto.ProtoFile == "" {
+			return nil, fmt.Errorf("Invalid protos setting: item %d: protoName or protoFile required", i)
+		}
+		protos = append(protos, proto)
+	}
+	return protos, nil
+}
 
+// HandlerSettings struct
+type HandlerSettings struct {
+	ServiceName   string `md:"serviceName"`
+	MethodName    string `md:"methodName"`
+	SubjectFilter string `md:"subjectFilter"`
+	Fallback      bool   `md:"fallback"`
+	Timeout       int    `md:"timeout"` // Milliseconds
+}
+
+// FromMap method of HandlerSettings
+func (h *HandlerSettings) FromMap(values map[string]interface{}) error {
+	var err error
+
+	h.ServiceName, err = coerce.ToString(values["serviceName"])
+	if err != nil {
+		return err
+	}
+
+	h.MethodName, err = coerce.ToString(values["methodName"])
+	if err != nil {
+		return err
+	}
+
+	h.SubjectFilter, err = coerce.ToString(values["subjectFilter"])
+	if err != nil {
+		return err
+	}
+
+	h.Fallback, err = coerce.ToBool(values["fallback"])
+	if err != nil {
+		return err
+	}
+
+	h.Timeout, err = coerce.ToInt(values["timeout"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap method of HandlerSettings
+func (h *HandlerSettings) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"serviceName":   h.ServiceName,
+		"methodName":    h.MethodName,
+		"subjectFilter": h.SubjectFilter,
+		"fallback":      h.Fallback,
+		"timeout":       h.Timeout,
+	}
+}
+
+// timeout returns how long the flows of the handler run when the caller sets no deadline, zero when unset
+func (h *HandlerSettings) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 0
+	}
+	return time.Duration(h.Timeout) * time.Millisecond
+}
+
+// Matches reports whether a call of methodName on serviceName received on subject is bound to the handler,
+// empty settings match everything
+func (h *HandlerSettings) Matches(serviceName, methodName, subject string) bool {
+	if h.ServiceName != "" && h.ServiceName != serviceName {
+		return false
+	}
+	if h.MethodName != "" && h.MethodName != methodName {
+		return false
+	}
+	if h.SubjectFilter != "" && !subjectMatches(h.SubjectFilter, subject) {
+		return false
+	}
+	return true
+}
+
+// specificity ranks the handler bindings, a method binding wins over a service binding
+// which wins over a subject filter only binding
+func (h *HandlerSettings) specificity() int {
+	specificity := 0
+	if h.ServiceName != "" {
+		specificity += 4
+	}
+	if h.MethodName != "" {
+		specificity += 2
+	}
+	if h.SubjectFilter != "" {
+		specificity++
+	}
+	return specificity
+}
+
+// subjectMatches reports whether subject matches the NATS subject filter, supporting '*' and '>' wildcards
+func subjectMatches(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
 }
 
 type Output struct {
-	NrpcData map[string]interface{} `md:"nrpcData"`
+	NrpcData           map[string]interface{} `md:"nrpcData"`
 	ProtobufRequestMap map[string]interface{} `md:"protobufRequestMap"`
+	Metadata           map[string]interface{} `md:"metadata"` // Subjects, encoding and subject parameters of the call
+	Headers            map[string]string      `md:"headers"`  // NATS headers of the request message
+	Params             map[string]string      `md:"params"`   // nRPC subject parameters by name
 }
 
 func (o *Output) FromMap(values map[string]interface{}) error {
@@ -183,19 +594,40 @@ func (o *Output) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	o.Metadata, err = coerce.ToObject(values["metadata"])
+	if err != nil {
+		return err
+	}
+
+	o.Headers, err = coerce.ToParams(values["headers"])
+	if err != nil {
+		return err
+	}
+
+	o.Params, err = coerce.ToParams(values["params"])
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (o *Output) ToMap() map[string]interface{} {
 	return map[string]interface{}{
-		"nrpcData": o.NrpcData,
+		"nrpcData":           o.NrpcData,
 		"protobufRequestMap": o.ProtobufRequestMap,
+		"metadata":           o.Metadata,
+		"headers":            o.Headers,
+		"params":             o.Params,
 	}
 }
 
 type Reply struct {
-	Code int         `md:"code"`
-	Data interface{} `md:"data"`
+	Code    int               `md:"code"`    // 0 or 2xx on success, other codes are replied as nrpc errors
+	Data    interface{}       `md:"data"`    // Reply message data, the items of an array are streamed by server-streaming methods
+	Message string            `md:"message"` // Message of the error replied
+	Details interface{}       `md:"details"` // Details of the error replied
+	Headers map[string]string `md:"headers"` // NATS headers of the reply message of unary methods
 }
 
 func (r *Reply) FromMap(values map[string]interface{}) error {
@@ -211,12 +643,27 @@ func (r *Reply) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	r.Message, err = coerce.ToString(values["message"])
+	if err != nil {
+		return err
+	}
+
+	r.Details = values["details"]
+
+	r.Headers, err = coerce.ToParams(values["headers"])
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (r *Reply) ToMap() map[string]interface{} {
 	return map[string]interface{}{
-		"code": r.Code,
-		"data": r.Data,
+		"code":    r.Code,
+		"data":    r.Data,
+		"message": r.Message,
+		"details": r.Details,
+		"headers": r.Headers,
 	}
 }
@@ -0,0 +1,422 @@
+package nrpc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/project-flogo/core/data/coerce"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// wrapperTypes are the well-known wrapper messages, converted to the value they wrap
+var wrapperTypes = map[protoreflect.FullName]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// messageToMap converts msg into flow data: the fields are keyed by their proto name, 64-bit
+// integers keep their Go type, enums are their value name, bytes are []byte, Timestamp is a
+// time.Time, Duration is a duration string, wrappers are their value and Struct, Value and
+// ListValue are JSON like values. Unset message and oneof fields are left out.
+func messageToMap(msg proto.Message) map[string]interface{} {
+	return reflectMessageToMap(msg.ProtoReflect())
+}
+
+// flowValue converts the messages found in v, through maps and slices, into flow data
+func flowValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case proto.Message:
+		return messageToMap(v)
+	case []proto.Message:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = messageToMap(item)
+		}
+		return items
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = flowValue(item)
+		}
+		return items
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			values[key] = flowValue(item)
+		}
+		return values
+	}
+	return v
+}
+
+// setMessage sets the fields of msg from flow data, keys are matched with the proto names of the
+// fields, then their JSON names and then their proto names regardless of case. Unknown keys and
+// nil values are ignored.
+func setMessage(msg proto.Message, data interface{}) error {
+	return setReflectMessage(msg.ProtoReflect(), flowValue(data))
+}
+
+func reflectMessageToMap(m protoreflect.Message) map[string]interface{} {
+	fields := m.Descriptor().Fields()
+	values := make(map[string]interface{}, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.HasPresence() && !m.Has(fd) {
+			continue
+		}
+		values[string(fd.Name())] = fieldToFlow(fd, m.Get(fd))
+	}
+	return values
+}
+
+func fieldToFlow(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]interface{}, list.Len())
+		for i := range items {
+			items[i] = singularToFlow(fd, list.Get(i))
+		}
+		return items
+	case fd.IsMap():
+		values := make(map[string]interface{}, v.Map().Len())
+		v.Map().Range(func(key protoreflect.MapKey, item protoreflect.Value) bool {
+			values[key.String()] = singularToFlow(fd.MapValue(), item)
+			return true
+		})
+		return values
+	}
+	return singularToFlow(fd, v)
+}
+
+func singularToFlow(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil
+		}
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name())
+		}
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageToFlow(v.Message())
+	}
+	return v.Interface()
+}
+
+// messageToFlow converts a message field, well-known types are converted to their flow values
+func messageToFlow(m protoreflect.Message) interface{} {
+	desc := m.Descriptor()
+	fields := desc.Fields()
+
+	switch name := desc.FullName(); {
+	case wrapperTypes[name]:
+		return m.Get(fields.ByName("value")).Interface()
+	case name == "google.protobuf.Timestamp":
+		return time.Unix(m.Get(fields.ByName("seconds")).Int(), m.Get(fields.ByName("nanos")).Int()).UTC()
+	case name == "google.protobuf.Duration":
+		seconds, nanos := m.Get(fields.ByName("seconds")).Int(), m.Get(fields.ByName("nanos")).Int()
+		return (time.Duration(seconds)*time.Second + time.Duration(nanos)).String()
+	case name == "google.protobuf.Struct":
+		return fieldToFlow(fields.ByName("fields"), m.Get(fields.ByName("fields")))
+	case name == "google.protobuf.ListValue":
+		return fieldToFlow(fields.ByName("values"), m.Get(fields.ByName("values")))
+	case name == "google.protobuf.Value":
+		fd := m.WhichOneof(desc.Oneofs().ByName("kind"))
+		if fd == nil {
+			return nil
+		}
+		return singularToFlow(fd, m.Get(fd))
+	}
+	return reflectMessageToMap(m)
+}
+
+func setReflectMessage(m protoreflect.Message, data interface{}) error {
+	values, err := coerce.ToObject(data)
+	if err != nil {
+		return err
+	}
+
+	fields := m.Descriptor().Fields()
+	for key, value := range values {
+		fd := lookupField(fields, key)
+		if fd == nil || value == nil {
+			continue
+		}
+		if err := setField(m, fd, value); err != nil {
+			return fmt.Errorf("invalid %s field: %v", fd.Name(), err)
+		}
+	}
+	return nil
+}
+
+func lookupField(fields protoreflect.FieldDescriptors, key string) protoreflect.FieldDescriptor {
+	if fd := fields.ByName(protoreflect.Name(key)); fd != nil {
+		return fd
+	}
+	if fd := fields.ByJSONName(key); fd != nil {
+		return fd
+	}
+	for i := 0; i < fields.Len(); i++ {
+		if strings.EqualFold(string(fields.Get(i).Name()), key) {
+			return fields.Get(i)
+		}
+	}
+	return nil
+}
+
+func setField(m protoreflect.Message, fd protoreflect.FieldDescriptor, value interface{}) error {
+	switch {
+	case fd.IsList():
+		items, err := coerce.ToArray(value)
+		if err != nil {
+			return err
+		}
+		list := m.Mutable(fd).List()
+		for _, item := range items {
+			v, err := flowToValue(fd, item, list.NewElement)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+	case fd.IsMap():
+		items, err := coerce.ToObject(value)
+		if err != nil {
+			return err
+		}
+		entries := m.Mutable(fd).Map()
+		for key, item := range items {
+			k, err := flowToValue(fd.MapKey(), key, nil)
+			if err != nil {
+				return err
+			}
+			v, err := flowToValue(fd.MapValue(), item, entries.NewValue)
+			if err != nil {
+				return err
+			}
+			entries.Set(k.MapKey(), v)
+		}
+	default:
+		v, err := flowToValue(fd, value, func() protoreflect.Value { return m.NewField(fd) })
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+// flowToValue converts a flow value into a singular value of the field, newValue returns a new
+// message value of a message field
+func flowToValue(fd protoreflect.FieldDescriptor, value interface{}, newValue func() protoreflect.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := coerce.ToBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := toInt(value, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := toInt(value, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := toUint(value, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := toUint(value, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := coerce.ToFloat32(value)
+		return protoreflect.ValueOfFloat32(f), err
+	case protoreflect.DoubleKind:
+		f, err := coerce.ToFloat64(value)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		s, err := coerce.ToString(value)
+		return protoreflect.ValueOfString(s), err
+	case protoreflect.BytesKind:
+		b, err := toBytes(value)
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		n, err := toEnum(fd.Enum(), value)
+		return protoreflect.ValueOfEnum(n), err
+	}
+
+	v := newValue()
+	return v, setMessageField(v.Message(), value)
+}
+
+// setMessageField sets a message field from its flow value, well-known types are set from their
+// flow values
+func setMessageField(m protoreflect.Message, value interface{}) error {
+	desc := m.Descriptor()
+	fields := desc.Fields()
+
+	switch name := desc.FullName(); {
+	case wrapperTypes[name]:
+		return setField(m, fields.ByName("value"), value)
+	case name == "google.protobuf.Timestamp":
+		t, err := coerce.ToDateTime(value)
+		if err != nil {
+			return err
+		}
+		m.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+		m.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+		return nil
+	case name == "google.protobuf.Duration":
+		d, err := toDuration(value)
+		if err != nil {
+			return err
+		}
+		m.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(int64(d/time.Second)))
+		m.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(d%time.Second)))
+		return nil
+	case name == "google.protobuf.Struct":
+		return setField(m, fields.ByName("fields"), value)
+	case name == "google.protobuf.ListValue":
+		return setField(m, fields.ByName("values"), value)
+	case name == "google.protobuf.Value":
+		return setValue(m, value)
+	}
+	return setReflectMessage(m, value)
+}
+
+// setValue sets the kind of a google.protobuf.Value from a JSON like value
+func setValue(m protoreflect.Message, value interface{}) error {
+	fields := m.Descriptor().Fields()
+
+	var fieldName protoreflect.Name
+	switch value.(type) {
+	case nil:
+		m.Set(fields.ByName("null_value"), protoreflect.ValueOfEnum(0))
+		return nil
+	case bool:
+		fieldName = "bool_value"
+	case string:
+		fieldName = "string_value"
+	case map[string]interface{}:
+		fieldName = "struct_value"
+	case []interface{}:
+		fieldName = "list_value"
+	default:
+		fieldName = "number_value"
+	}
+	return setField(m, fields.ByName(fieldName), value)
+}
+
+// toInt converts a flow value into an integer of bitSize bits, strings keep the precision of
+// 64-bit integers
+func toInt(value interface{}, bitSize int) (int64, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, bitSize)
+	case json.Number:
+		return strconv.ParseInt(string(v), 10, bitSize)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int%d", v, bitSize)
+		}
+	case float32, float64:
+		f, _ := coerce.ToFloat64(v)
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an int%d", v, bitSize)
+		}
+	}
+
+	n, err := coerce.ToInt64(value)
+	if err != nil {
+		return 0, err
+	}
+	if bitSize == 32 && (n < math.MinInt32 || n > math.MaxInt32) {
+		return 0, fmt.Errorf("%d overflows int32", n)
+	}
+	return n, nil
+}
+
+// toUint converts a flow value into an unsigned integer of bitSize bits
+func toUint(value interface{}, bitSize int) (uint64, error) {
+	var n uint64
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseUint(strings.TrimSpace(v), 10, bitSize)
+	case json.Number:
+		return strconv.ParseUint(string(v), 10, bitSize)
+	case uint:
+		n = uint64(v)
+	case uint32:
+		n = uint64(v)
+	case uint64:
+		n = v
+	default:
+		i, err := toInt(value, 64)
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			return 0, fmt.Errorf("%d is negative", i)
+		}
+		n = uint64(i)
+	}
+
+	if bitSize == 32 && n > math.MaxUint32 {
+		return 0, fmt.Errorf("%d overflows uint32", n)
+	}
+	return n, nil
+}
+
+// toBytes converts a flow value into bytes, strings are base64 encoded as in the JSON mapping of
+// proto3
+func toBytes(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return coerce.ToBytes(value)
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// toEnum converts an enum value name or number into an enum number
+func toEnum(enum protoreflect.EnumDescriptor, value interface{}) (protoreflect.EnumNumber, error) {
+	if name, ok := value.(string); ok {
+		if v := enum.Values().ByName(protoreflect.Name(name)); v != nil {
+			return v.Number(), nil
+		}
+	}
+
+	n, err := toInt(value, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown %s value: %v", enum.Name(), value)
+	}
+	return protoreflect.EnumNumber(n), nil
+}
+
+// toDuration converts a duration string, or a number of nanoseconds, into a duration
+func toDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+
+	n, err := toInt(value, 64)
+	return time.Duration(n), err
+}
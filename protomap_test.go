@@ -0,0 +1,175 @@
+package nrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testSampleProto = `syntax = "proto3";
+
+package test;
+
+import "google/protobuf/duration.proto";
+import "google/protobuf/struct.proto";
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/wrappers.proto";
+
+message Sample {
+  enum Kind {
+    UNKNOWN = 0;
+    SMALL = 1;
+    LARGE = 2;
+  }
+
+  int64 big = 1;
+  uint64 ubig = 2;
+  Kind kind = 3;
+  bytes raw = 4;
+  oneof choice {
+    string text = 5;
+    int32 number = 6;
+  }
+  google.protobuf.Timestamp created_at = 7;
+  google.protobuf.Duration ttl = 8;
+  google.protobuf.StringValue label = 9;
+  google.protobuf.Struct attributes = 10;
+  repeated Sample children = 11;
+  map<string, int64> counts = 12;
+  double ratio = 13;
+}
+`
+
+type ProtoMapTestSuite struct {
+	suite.Suite
+}
+
+// newSample returns an empty test.Sample message
+func (suite *ProtoMapTestSuite) newSample() proto.Message {
+	t := suite.T()
+
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"sample.proto": testSampleProto}),
+	}
+	fds, err := parser.ParseFiles("sample.proto")
+	if !assert.Nil(t, err, "Cannot parse sample.proto") {
+		t.FailNow()
+	}
+
+	file, err := protodesc.NewFile(fds[0].AsFileDescriptorProto(), protoregistry.GlobalFiles)
+	if !assert.Nil(t, err, "Cannot build sample.proto descriptor") {
+		t.FailNow()
+	}
+	return dynamicpb.NewMessage(file.Messages().ByName("Sample"))
+}
+
+func (suite *ProtoMapTestSuite) TestRoundTrip() {
+	t := suite.T()
+
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	msg := suite.newSample()
+	err := setMessage(msg, map[string]interface{}{
+		"big":        int64(9007199254740993),
+		"ubig":       uint64(18446744073709551615),
+		"kind":       "LARGE",
+		"raw":        []byte{0, 1, 2},
+		"number":     7,
+		"created_at": createdAt,
+		"ttl":        "1m30s",
+		"label":      "tag",
+		"attributes": map[string]interface{}{"a": "x", "b": 1.5, "c": []interface{}{true, nil}},
+		"children":   []interface{}{map[string]interface{}{"text": "child"}},
+		"counts":     map[string]interface{}{"a": int64(1)},
+		"ratio":      0.5,
+	})
+	assert.Nil(t, err, "setMessage error")
+
+	data := messageToMap(msg)
+	assert.Equal(t, int64(9007199254740993), data["big"])
+	assert.Equal(t, uint64(18446744073709551615), data["ubig"])
+	assert.Equal(t, "LARGE", data["kind"])
+	assert.Equal(t, []byte{0, 1, 2}, data["raw"])
+	assert.Equal(t, int32(7), data["number"])
+	assert.NotContains(t, data, "text", "Unset oneof fields are left out")
+	assert.Equal(t, createdAt, data["created_at"])
+	assert.Equal(t, "1m30s", data["ttl"])
+	assert.Equal(t, "tag", data["label"])
+	assert.Equal(t, map[string]interface{}{"a": "x", "b": 1.5, "c": []interface{}{true, nil}}, data["attributes"])
+	assert.Equal(t, map[string]interface{}{"a": int64(1)}, data["counts"])
+	assert.Equal(t, 0.5, data["ratio"])
+
+	children := data["children"].([]interface{})
+	if assert.Len(t, children, 1) {
+		child := children[0].(map[string]interface{})
+		assert.Equal(t, "child", child["text"])
+		assert.Equal(t, "UNKNOWN", child["kind"])
+		assert.NotContains(t, child, "created_at", "Unset message fields are left out")
+	}
+
+	// Messages in the flow data are converted too
+	copied := suite.newSample()
+	err = setMessage(copied, map[string]interface{}{"children": []interface{}{msg}})
+	assert.Nil(t, err, "setMessage error")
+	assert.Equal(t, []interface{}{data}, messageToMap(copied)["children"])
+}
+
+func (suite *ProtoMapTestSuite) TestSetMessageFromJSONData() {
+	t := suite.T()
+
+	msg := suite.newSample()
+	err := setMessage(msg, map[string]interface{}{
+		"big":       "9007199254740993",
+		"kind":      float64(1),
+		"raw":       "AAEC",
+		"createdAt": "2020-01-02T03:04:05.000000006Z",
+		"ttl":       "1.500s",
+		"Ratio":     "0.25",
+		"unknown":   "ignored",
+	})
+	assert.Nil(t, err, "setMessage error")
+
+	data := messageToMap(msg)
+	assert.Equal(t, int64(9007199254740993), data["big"])
+	assert.Equal(t, "SMALL", data["kind"])
+	assert.Equal(t, []byte{0, 1, 2}, data["raw"])
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), data["created_at"])
+	assert.Equal(t, "1.5s", data["ttl"])
+	assert.Equal(t, 0.25, data["ratio"])
+}
+
+func (suite *ProtoMapTestSuite) TestSetMessageErrors() {
+	t := suite.T()
+
+	for field, value := range map[string]interface{}{
+		"kind":     "HUGE",
+		"number":   int64(1) << 40,
+		"big":      1.5,
+		"ubig":     -1,
+		"ttl":      "soon",
+		"children": []interface{}{map[string]interface{}{"kind": "HUGE"}},
+	} {
+		err := setMessage(suite.newSample(), map[string]interface{}{field: value})
+		if assert.NotNil(t, err, "Expected an error for %s", field) {
+			assert.Contains(t, err.Error(), "invalid "+field+" field")
+		}
+	}
+
+	err := setMessage(suite.newSample(), "not an object")
+	assert.NotNil(t, err, "Expected an error for invalid data")
+}
+
+func TestProtoMapTestSuite(t *testing.T) {
+	suite.Run(t, new(ProtoMapTestSuite))
+}
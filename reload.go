@@ -0,0 +1,242 @@
+package nrpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt"
+	"github.com/nats-io/nkeys"
+	"github.com/project-flogo/core/support/log"
+)
+
+// fileStamp identifies the version of a watched file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// credentialReloader keeps the TLS client certificate and the NATS credentials loaded from
+// the certFile, keyFile, natsCredentialFile and natsNkeySeedfile settings, and reloads them
+// when the files change. NATS connections read the current material on each (re)connect,
+// the previous material is kept when the new files are invalid.
+type credentialReloader struct {
+	settings   *Settings
+	logger     log.Logger
+	stamps     map[string]fileStamp
+	clientCert *tls.Certificate
+	userJWT    string
+	userKey    nkeys.KeyPair
+	nkey       nkeys.KeyPair
+	nkeyPublic string
+	stopChan   chan bool
+	stopOnce   sync.Once
+	mutex      sync.Mutex
+}
+
+// newCredentialReloader loads the credential files defined in settings, it returns nil when
+// none is defined
+func newCredentialReloader(logger log.Logger, settings *Settings) (*credentialReloader, error) {
+	if settings.CertFile == "" && settings.KeyFile == "" && settings.NatsCredentialFile == "" && settings.NatsNkeySeedfile == "" {
+		return nil, nil
+	}
+
+	r := &credentialReloader{
+		settings: settings,
+		logger:   logger,
+		stamps:   make(map[string]fileStamp),
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		if settings.CertFile == "" {
+			return nil, fmt.Errorf("Missing certFile setting, required when keyFile is defined")
+		}
+		if settings.KeyFile == "" {
+			return nil, fmt.Errorf("Missing keyFile setting, required when certFile is defined")
+		}
+		r.changed(settings.CertFile, settings.KeyFile)
+		if err := r.loadClientCertificate(); err != nil {
+			return nil, fmt.Errorf("Invalid certFile or keyFile setting: %v", err)
+		}
+	}
+
+	// Only the credentials used by getNatsConnAuthOpts are loaded
+	if settings.NatsUserName == "" && settings.NatsToken == "" {
+		if settings.NatsNkeySeedfile != "" {
+			r.changed(settings.NatsNkeySeedfile)
+			if err := r.loadNkeySeed(); err != nil {
+				return nil, fmt.Errorf("Invalid natsNkeySeedfile setting: %v", err)
+			}
+		} else if settings.NatsCredentialFile != "" {
+			r.changed(settings.NatsCredentialFile)
+			if err := r.loadUserCredentials(); err != nil {
+				return nil, fmt.Errorf("Invalid natsCredentialFile setting: %v", err)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// start polls the credential files every interval until stop is called
+func (r *credentialReloader) start(interval time.Duration) {
+	stopChan := make(chan bool)
+	r.stopChan = stopChan
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.reload()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops polling the credential files, once
+func (r *credentialReloader) stop() {
+	r.stopOnce.Do(func() {
+		if r.stopChan != nil {
+			close(r.stopChan)
+		}
+	})
+}
+
+// reload loads the credential files changed since the last check
+func (r *credentialReloader) reload() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clientCert != nil && r.changed(r.settings.CertFile, r.settings.KeyFile) {
+		if err := r.loadClientCertificate(); err != nil {
+			r.logger.Errorf("Cannot reload TLS client certificate [%s], keeping the previous one: %v", r.settings.CertFile, err)
+		} else {
+			r.logger.Infof("Reloaded TLS client certificate [%s]", r.settings.CertFile)
+		}
+	}
+
+	if r.nkey != nil && r.changed(r.settings.NatsNkeySeedfile) {
+		if err := r.loadNkeySeed(); err != nil {
+			r.logger.Errorf("Cannot reload NATS nkey seed file [%s], keeping the previous one: %v", r.settings.NatsNkeySeedfile, err)
+		} else {
+			r.logger.Infof("Reloaded NATS nkey seed file [%s]", r.settings.NatsNkeySeedfile)
+		}
+	}
+
+	if r.userKey != nil && r.changed(r.settings.NatsCredentialFile) {
+		if err := r.loadUserCredentials(); err != nil {
+			r.logger.Errorf("Cannot reload NATS credential file [%s], keeping the previous one: %v", r.settings.NatsCredentialFile, err)
+		} else {
+			r.logger.Infof("Reloaded NATS credential file [%s]", r.settings.NatsCredentialFile)
+		}
+	}
+}
+
+// changed reports whether any of the files changed since the last check and records their
+// current version. Unreadable files are reported as changed so that loading them fails.
+func (r *credentialReloader) changed(files ...string) bool {
+	changed := false
+	for _, file := range files {
+		var stamp fileStamp
+		if info, err := os.Stat(file); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		if previous, ok := r.stamps[file]; !ok || previous != stamp {
+			changed = true
+		}
+		r.stamps[file] = stamp
+	}
+	return changed
+}
+
+func (r *credentialReloader) loadClientCertificate() error {
+	cert, err := tls.LoadX509KeyPair(r.settings.CertFile, r.settings.KeyFile)
+	if err != nil {
+		return err
+	}
+	r.clientCert = &cert
+	return nil
+}
+
+func (r *credentialReloader) loadNkeySeed() error {
+	contents, err := ioutil.ReadFile(r.settings.NatsNkeySeedfile)
+	if err != nil {
+		return err
+	}
+	kp, err := jwt.ParseDecoratedNKey(contents)
+	if err != nil {
+		return err
+	}
+	public, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	// The nkey public key is part of the connection options and cannot change on reconnect
+	if r.nkeyPublic != "" && public != r.nkeyPublic {
+		return fmt.Errorf("nkey public key changed from [%s] to [%s], restart the trigger to use the new nkey", r.nkeyPublic, public)
+	}
+	r.nkey = kp
+	r.nkeyPublic = public
+	return nil
+}
+
+func (r *credentialReloader) loadUserCredentials() error {
+	contents, err := ioutil.ReadFile(r.settings.NatsCredentialFile)
+	if err != nil {
+		return err
+	}
+	userJWT, err := jwt.ParseDecoratedJWT(contents)
+	if err != nil {
+		return err
+	}
+	if _, err := jwt.DecodeUserClaims(userJWT); err != nil {
+		return err
+	}
+	kp, err := jwt.ParseDecoratedUserNKey(contents)
+	if err != nil {
+		return err
+	}
+	r.userJWT = userJWT
+	r.userKey = kp
+	return nil
+}
+
+// getClientCertificate implements tls.Config.GetClientCertificate
+func (r *credentialReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.reload()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.clientCert, nil
+}
+
+// getUserJWT implements nats.UserJWTHandler
+func (r *credentialReloader) getUserJWT() (string, error) {
+	r.reload()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.userJWT, nil
+}
+
+// signUserNonce implements nats.SignatureHandler with the user credentials
+func (r *credentialReloader) signUserNonce(nonce []byte) ([]byte, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.userKey.Sign(nonce)
+}
+
+// signNkeyNonce implements nats.SignatureHandler with the nkey seed
+func (r *credentialReloader) signNkeyNonce(nonce []byte) ([]byte, error) {
+	r.reload()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.nkey.Sign(nonce)
+}
@@ -0,0 +1,257 @@
+package nrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/jwt"
+	"github.com/nats-io/nkeys"
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	natsserver "github.com/nats-io/nats-server/test"
+)
+
+type ReloadTestSuite struct {
+	suite.Suite
+	certDir string
+}
+
+func (suite *ReloadTestSuite) SetupTest() {
+	var err error
+
+	suite.certDir, err = ioutil.TempDir("", "flogo-nrpc-reload")
+	suite.Require().Nil(err, "Cannot create cert dir")
+}
+
+func (suite *ReloadTestSuite) TearDownTest() {
+	os.RemoveAll(suite.certDir)
+}
+
+func (suite *ReloadTestSuite) file(name string) string {
+	return filepath.Join(suite.certDir, name)
+}
+
+// rotate writes contents to the file with a newer modification time than the previous version
+func (suite *ReloadTestSuite) rotate(name string, contents []byte) {
+	err := ioutil.WriteFile(suite.file(name), contents, 0600)
+	suite.Require().Nil(err, "Cannot write file")
+	suite.touch(name)
+}
+
+// touch sets a newer modification time, rotations within the file system time resolution
+// would not be detected otherwise
+func (suite *ReloadTestSuite) touch(name string) {
+	info, err := os.Stat(suite.file(name))
+	suite.Require().Nil(err, "Cannot stat file")
+	modTime := info.ModTime().Add(time.Second)
+	suite.Require().Nil(os.Chtimes(suite.file(name), modTime, modTime), "Cannot touch file")
+}
+
+func (suite *ReloadTestSuite) TestNewCredentialReloader() {
+	t := suite.T()
+
+	r, err := newCredentialReloader(log.RootLogger(), &Settings{})
+	assert.Nil(t, err, "newCredentialReloader error")
+	assert.Nil(t, r, "No reloader expected without credential files")
+
+	_, err = newCredentialReloader(log.RootLogger(), &Settings{CertFile: suite.file("missing.pem"), KeyFile: suite.file("missing-key.pem")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "certFile or keyFile")
+
+	_, err = newCredentialReloader(log.RootLogger(), &Settings{NatsCredentialFile: suite.file("missing.creds")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "natsCredentialFile")
+}
+
+func (suite *ReloadTestSuite) TestReloadClientCertificate() {
+	t := suite.T()
+
+	caCert, caKey := writeTestCert(t, suite.certDir, "ca", nil, nil)
+	first, _ := writeTestCert(t, suite.certDir, "client", caCert, caKey)
+
+	r, err := newCredentialReloader(log.RootLogger(), &Settings{
+		CertFile: suite.file("client.pem"),
+		KeyFile:  suite.file("client-key.pem"),
+	})
+	assert.Nil(t, err, "newCredentialReloader error")
+
+	cert, err := r.getClientCertificate(nil)
+	assert.Nil(t, err, "getClientCertificate error")
+	assert.Equal(t, first.Raw, cert.Certificate[0])
+
+	// Rotated certificate
+	second, _ := writeTestCert(t, suite.certDir, "client", caCert, caKey)
+	suite.touch("client.pem")
+	suite.touch("client-key.pem")
+	r.reload()
+	cert, _ = r.getClientCertificate(nil)
+	assert.Equal(t, second.Raw, cert.Certificate[0], "Rotated certificate should be loaded")
+
+	// Invalid certificate keeps the previous one
+	suite.rotate("client.pem", []byte("invalid"))
+	r.reload()
+	cert, _ = r.getClientCertificate(nil)
+	assert.Equal(t, second.Raw, cert.Certificate[0], "Previous certificate should be kept")
+}
+
+func (suite *ReloadTestSuite) TestReloadUserCredentials() {
+	t := suite.T()
+
+	account, err := nkeys.CreateAccount()
+	assert.Nil(t, err, "Cannot create account nkey")
+
+	first := suite.userCredentials(account)
+	suite.rotate("user.creds", first)
+
+	r, err := newCredentialReloader(log.RootLogger(), &Settings{NatsCredentialFile: suite.file("user.creds")})
+	assert.Nil(t, err, "newCredentialReloader error")
+
+	firstJWT, _ := jwt.ParseDecoratedJWT(first)
+	userJWT, err := r.getUserJWT()
+	assert.Nil(t, err, "getUserJWT error")
+	assert.Equal(t, firstJWT, userJWT)
+
+	// Rotated credentials
+	second := suite.userCredentials(account)
+	suite.rotate("user.creds", second)
+	secondJWT, _ := jwt.ParseDecoratedJWT(second)
+	userJWT, _ = r.getUserJWT()
+	assert.Equal(t, secondJWT, userJWT, "Rotated credentials should be loaded")
+
+	secondKey, _ := jwt.ParseDecoratedUserNKey(second)
+	nonce := []byte("nonce")
+	sig, err := r.signUserNonce(nonce)
+	assert.Nil(t, err, "signUserNonce error")
+	assert.Nil(t, secondKey.Verify(nonce, sig), "Nonce should be signed with the rotated user nkey")
+
+	// Invalid credentials keep the previous ones
+	suite.rotate("user.creds", []byte("invalid"))
+	userJWT, _ = r.getUserJWT()
+	assert.Equal(t, secondJWT, userJWT, "Previous credentials should be kept")
+}
+
+func (suite *ReloadTestSuite) TestReloadNkeySeed() {
+	t := suite.T()
+
+	user, err := nkeys.CreateUser()
+	assert.Nil(t, err, "Cannot create user nkey")
+	seed, _ := user.Seed()
+	public, _ := user.PublicKey()
+	suite.rotate("user.nk", seed)
+
+	r, err := newCredentialReloader(log.RootLogger(), &Settings{NatsNkeySeedfile: suite.file("user.nk")})
+	assert.Nil(t, err, "newCredentialReloader error")
+	assert.Equal(t, public, r.nkeyPublic)
+
+	// A seed of another nkey cannot be used without reconnecting with a new public key
+	other, _ := nkeys.CreateUser()
+	otherSeed, _ := other.Seed()
+	suite.rotate("user.nk", otherSeed)
+
+	nonce := []byte("nonce")
+	sig, err := r.signNkeyNonce(nonce)
+	assert.Nil(t, err, "signNkeyNonce error")
+	assert.Nil(t, user.Verify(nonce, sig), "Previous nkey should be kept")
+	assert.Equal(t, public, r.nkeyPublic)
+}
+
+func (suite *ReloadTestSuite) TestReloaderStop() {
+	t := suite.T()
+
+	user, err := nkeys.CreateUser()
+	assert.Nil(t, err, "Cannot create user nkey")
+	seed, _ := user.Seed()
+	suite.rotate("user.nk", seed)
+
+	r, err := newCredentialReloader(log.RootLogger(), &Settings{NatsNkeySeedfile: suite.file("user.nk")})
+	assert.Nil(t, err, "newCredentialReloader error")
+
+	// The reloader is stopped while polling, stopping it again is harmless
+	r.start(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.NotPanics(t, func() {
+		r.stop()
+		r.stop()
+	})
+}
+
+func (suite *ReloadTestSuite) TestNatsReconnectWithRotatedCertificate() {
+	t := suite.T()
+
+	caCert, caKey := writeTestCert(t, suite.certDir, "ca", nil, nil)
+	writeTestCert(t, suite.certDir, "server", caCert, caKey)
+	writeTestCert(t, suite.certDir, "client", caCert, caKey)
+
+	serverCert, err := tls.LoadX509KeyPair(suite.file("server.pem"), suite.file("server-key.pem"))
+	assert.Nil(t, err, "Cannot load server certificate")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = 4444
+	opts.TLSVerify = true
+	opts.TLSTimeout = 2
+	opts.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	s := natsserver.RunServer(&opts)
+
+	settings := &Settings{
+		NatsClusterUrls: "nats://localhost:4444",
+		AutoReconnect:   true,
+		ReconnectWait:   1,
+		CaFile:          suite.file("ca.pem"),
+		CertFile:        suite.file("client.pem"),
+		KeyFile:         suite.file("client-key.pem"),
+	}
+	r, err := newCredentialReloader(log.RootLogger(), settings)
+	assert.Nil(t, err, "newCredentialReloader error")
+
+	nc, err := getNatsConnection(log.RootLogger(), settings, r)
+	assert.Nil(t, err, "mTLS connection error")
+	if nc == nil {
+		s.Shutdown()
+		return
+	}
+	defer nc.Close()
+
+	// The rotated certificate is used on reconnect
+	rotated, _ := writeTestCert(t, suite.certDir, "client", caCert, caKey)
+	suite.touch("client.pem")
+	suite.touch("client-key.pem")
+
+	s.Shutdown()
+	s = natsserver.RunServer(&opts)
+	defer s.Shutdown()
+
+	assert.Eventually(t, nc.IsConnected, 5*time.Second, 50*time.Millisecond, "Connection should reconnect")
+	cert, _ := r.getClientCertificate(nil)
+	assert.Equal(t, rotated.Raw, cert.Certificate[0])
+}
+
+func TestReloadTestSuite(t *testing.T) {
+	suite.Run(t, new(ReloadTestSuite))
+}
+
+// userCredentials returns a creds file content for a new user of account
+func (suite *ReloadTestSuite) userCredentials(account nkeys.KeyPair) []byte {
+	user, err := nkeys.CreateUser()
+	suite.Require().Nil(err, "Cannot create user nkey")
+	public, _ := user.PublicKey()
+	seed, _ := user.Seed()
+
+	userJWT, err := jwt.NewUserClaims(public).Encode(account)
+	suite.Require().Nil(err, "Cannot encode user JWT")
+	creds, err := jwt.FormatUserConfig(userJWT, seed)
+	suite.Require().Nil(err, "Cannot format creds file")
+	return creds
+}
@@ -0,0 +1,89 @@
+package nrpc
+
+import (
+	"context"
+	"fmt"
+
+	nrpc "github.com/nats-rpc/nrpc"
+)
+
+// router dispatches nRPC calls to the handler bound to their service and method
+type router struct {
+	handlers []*Handler
+	fallback *Handler
+}
+
+// newRouter creates a router for the trigger handlers, the first handler with the fallback
+// setting receives the calls no other handler is bound to
+func newRouter(handlers []*Handler) *router {
+	r := &router{}
+	for _, handler := range handlers {
+		if handler.handlerSettings.Fallback {
+			if r.fallback == nil {
+				r.fallback = handler
+			}
+			continue
+		}
+		r.handlers = append(r.handlers, handler)
+	}
+	return r
+}
+
+// route returns the most specific handler bound to the call, or the fallback handler
+// when none is bound
+func (r *router) route(serviceName, methodName, subject string) *Handler {
+	var (
+		matched *Handler
+		best    = -1
+	)
+
+	for _, handler := range r.handlers {
+		if !handler.handlerSettings.Matches(serviceName, methodName, subject) {
+			continue
+		}
+		// Keep the first handler among the most specific ones
+		if specificity := handler.handlerSettings.specificity(); specificity > best {
+			matched = handler
+			best = specificity
+		}
+	}
+
+	if matched == nil {
+		return r.fallback
+	}
+	return matched
+}
+
+// serviceHandler returns the first handler which may receive calls for serviceName
+func (r *router) serviceHandler(serviceName string) *Handler {
+	for _, handler := range r.handlers {
+		if handler.handlerSettings.ServiceName == "" || handler.handlerSettings.ServiceName == serviceName {
+			return handler
+		}
+	}
+	return r.fallback
+}
+
+// Dispatch routes the nRPC request data to the handler bound to its service and method and
+// waits for its reply. An nRPC client error is returned when no handler is bound to the method.
+func (t *Trigger) Dispatch(ctx context.Context, nrpcData map[string]interface{}) (*Reply, error) {
+	serviceName, _ := nrpcData["serviceName"].(string)
+	methodName, _ := nrpcData["methodName"].(string)
+	subject, _ := nrpcData["subject"].(string)
+
+	handler := t.router.route(serviceName, methodName, subject)
+	if handler == nil {
+		t.logger.Warnf("No handler bound to method [%s.%s]", serviceName, methodName)
+		return nil, &nrpc.Error{
+			Type:    nrpc.Error_CLIENT,
+			Message: fmt.Sprintf("unimplemented method: %s.%s", serviceName, methodName),
+		}
+	}
+
+	reply, err := handler.Dispatch(ctx, nrpcData)
+
+	// Durable requests are acknowledged once the flow succeeded
+	t.deliveries.complete(ctx, err)
+
+	return reply, err
+}
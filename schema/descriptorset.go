@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	// Well-known types imported by the files of the descriptor sets
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/apipb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/sourcecontextpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/typepb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// descriptorSetExtensions are the extensions of binary FileDescriptorSet files
+var descriptorSetExtensions = map[string]bool{
+	".pb":       true,
+	".protoset": true,
+	".desc":     true,
+	".binpb":    true,
+}
+
+// IsDescriptorSet reports whether fileName is a binary FileDescriptorSet rather than a .proto
+// source, from its extension
+func IsDescriptorSet(fileName string) bool {
+	return descriptorSetExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// ParseDescriptorSet parses a binary FileDescriptorSet, as written by protoc --descriptor_set_out
+// or buf build, and returns its files. The well-known protobuf types and the nrpc options are
+// added when the set does not include the imports of its files.
+func ParseDescriptorSet(data []byte) ([]*desc.FileDescriptor, error) {
+	set := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("Cannot parse descriptor set: %v", err)
+	}
+	if len(set.File) == 0 {
+		return nil, fmt.Errorf("Cannot parse descriptor set: no file")
+	}
+
+	included := make(map[string]bool, len(set.File))
+	for _, file := range set.File {
+		included[file.GetName()] = true
+	}
+
+	// Imports are added as they are found missing, theirs are checked in turn
+	all := append([]*descriptor.FileDescriptorProto(nil), set.File...)
+	for i := 0; i < len(all); i++ {
+		for _, dep := range all[i].GetDependency() {
+			if included[dep] {
+				continue
+			}
+			file, err := lookupImport(dep)
+			if err != nil {
+				return nil, fmt.Errorf("Cannot parse descriptor set: import %s of %s not included", dep, all[i].GetName())
+			}
+			included[dep] = true
+			all = append(all, file)
+		}
+	}
+
+	files, err := desc.CreateFileDescriptorsFromSet(&descriptor.FileDescriptorSet{File: all})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse descriptor set: %v", err)
+	}
+
+	result := make([]*desc.FileDescriptor, len(set.File))
+	for i, file := range set.File {
+		result[i] = files[file.GetName()]
+	}
+	return result, nil
+}
+
+// lookupImport returns the descriptor of a well-known protobuf type file or of the nrpc options
+func lookupImport(fileName string) (*descriptor.FileDescriptorProto, error) {
+	if nrpcImports[fileName] {
+		return lookupNrpcImport(fileName)
+	}
+
+	file, err := protoregistry.GlobalFiles.FindFileByPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return protodesc.ToFileDescriptorProto(file), nil
+}
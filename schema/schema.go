@@ -0,0 +1,85 @@
+// Package schema loads the protobuf descriptors of the nRPC services served by the trigger
+package schema
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// nrpcImports are the names nRPC protos use to import the nrpc options, they are resolved
+// with the nrpc package descriptor when not found in the import paths
+var nrpcImports = map[string]bool{
+	"nrpc.proto":      true,
+	"nrpc/nrpc.proto": true,
+}
+
+// ParseFiles parses the named .proto files, resolving their imports in importPaths. The
+// well-known protobuf types and the nrpc options are always available.
+func ParseFiles(importPaths []string, fileNames ...string) ([]*desc.FileDescriptor, error) {
+	parser := protoparse.Parser{
+		ImportPaths:           importPaths,
+		IncludeSourceCodeInfo: true,
+		LookupImportProto:     lookupNrpcImport,
+	}
+
+	files, err := parser.ParseFiles(fileNames...)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse proto files %v: %v", fileNames, err)
+	}
+	return files, nil
+}
+
+// ParseContent parses the .proto source content of fileName, set with a file picker. Only the
+// well-known protobuf types and the nrpc options can be imported.
+func ParseContent(fileName string, content []byte) ([]*desc.FileDescriptor, error) {
+	parser := protoparse.Parser{
+		Accessor:              protoparse.FileContentsFromMap(map[string]string{fileName: string(content)}),
+		IncludeSourceCodeInfo: true,
+		LookupImportProto:     lookupNrpcImport,
+	}
+
+	files, err := parser.ParseFiles(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot parse proto file %s: %v", fileName, err)
+	}
+	return files, nil
+}
+
+// lookupNrpcImport returns the nrpc options descriptor named as imported
+func lookupNrpcImport(fileName string) (*descriptor.FileDescriptorProto, error) {
+	if !nrpcImports[fileName] {
+		return nil, fmt.Errorf("File not found: %s", fileName)
+	}
+
+	fd := protodesc.ToFileDescriptorProto(nrpc.File_nrpc_proto)
+	fd.Name = proto.String(fileName)
+	return fd, nil
+}
+
+// FileContent returns the content of a file picker setting, either the file content itself or a
+// data URL
+func FileContent(content string) ([]byte, error) {
+	if !strings.HasPrefix(content, "data:") {
+		return []byte(content), nil
+	}
+
+	i := strings.Index(content, ",")
+	if i < 0 {
+		return nil, errors.New("invalid data URL")
+	}
+	if strings.HasSuffix(content[:i], ";base64") {
+		return base64.StdEncoding.DecodeString(content[i+1:])
+	}
+	data, err := url.PathUnescape(content[i+1:])
+	return []byte(data), err
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/proto"
+)
+
+type SchemaTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SchemaTestSuite) TestCamelCase() {
+	t := suite.T()
+
+	// The handlers know the services and methods by the names of the generated code
+	for _, name := range []string{"", "echo", "EchoService", "echo_service", "_echo", "echo__service", "echo2go", "echo_2_go", "ECHO_service", "a.b"} {
+		assert.Equal(t, generator.CamelCase(name), CamelCase(name), "CamelCase of %q", name)
+	}
+}
+
+func (suite *SchemaTestSuite) TestParseContent() {
+	t := suite.T()
+
+	files, err := ParseContent("echo.proto", []byte(`syntax = "proto3";
+package test;
+import "nrpc.proto";
+import "google/protobuf/wrappers.proto";
+option (nrpc.packageSubject) = "root";
+option (nrpc.methodSubjectRule) = TOLOWER;
+service EchoService {
+  rpc Echo(google.protobuf.StringValue) returns (google.protobuf.StringValue);
+}
+`))
+	if assert.Nil(t, err, "ParseContent error") && assert.Len(t, files, 1) {
+		service := files[0].GetServices()[0]
+		assert.Equal(t, "root", PackageSubject(files[0]))
+		assert.Equal(t, "EchoService", ServiceSubject(service))
+		assert.Equal(t, "echo", MethodSubject(service.GetMethods()[0]))
+		assert.False(t, StreamedReply(service.GetMethods()[0]))
+	}
+	if assert.Nil(t, err, "ParseContent error") {
+		assert.Empty(t, PackageSubjectParams(files[0]))
+		assert.Empty(t, MethodSubjectParams(files[0].GetServices()[0].GetMethods()[0]))
+	}
+
+	_, err = ParseContent("echo.proto", []byte(`syntax = "proto3"; import "missing.proto";`))
+	assert.NotNil(t, err, "Expected an error for a missing import")
+}
+
+func (suite *SchemaTestSuite) TestSubjectParams() {
+	t := suite.T()
+
+	files, err := ParseContent("user.proto", []byte(`syntax = "proto3";
+package test;
+import "nrpc.proto";
+import "google/protobuf/wrappers.proto";
+option (nrpc.packageSubject) = "acme";
+option (nrpc.packageSubjectParams) = "tenant";
+service UserService {
+  option (nrpc.serviceSubjectParams) = "region";
+  rpc Get(google.protobuf.StringValue) returns (google.protobuf.StringValue) {
+    option (nrpc.methodSubjectParams) = "shard";
+    option (nrpc.methodSubjectParams) = "version";
+  }
+}
+`))
+	if assert.Nil(t, err, "ParseContent error") {
+		service := files[0].GetServices()[0]
+		assert.Equal(t, []string{"tenant"}, PackageSubjectParams(files[0]))
+		assert.Equal(t, []string{"region"}, ServiceSubjectParams(service))
+		assert.Equal(t, []string{"shard", "version"}, MethodSubjectParams(service.GetMethods()[0]))
+	}
+}
+
+func (suite *SchemaTestSuite) TestParseDescriptorSet() {
+	t := suite.T()
+
+	files, err := ParseContent("event.proto", []byte(`syntax = "proto3";
+package test;
+import "google/protobuf/timestamp.proto";
+service EventService {
+  rpc Last(google.protobuf.Timestamp) returns (google.protobuf.Timestamp);
+}
+`))
+	if !assert.Nil(t, err, "ParseContent error") {
+		return
+	}
+
+	// The well-known types are not included
+	data, err := proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{files[0].AsFileDescriptorProto()}})
+	assert.Nil(t, err, "Cannot marshal descriptor set")
+	parsed, err := ParseDescriptorSet(data)
+	if assert.Nil(t, err, "ParseDescriptorSet error") && assert.Len(t, parsed, 1) {
+		method := parsed[0].GetServices()[0].GetMethods()[0]
+		assert.Equal(t, "google.protobuf.Timestamp", method.GetInputType().GetFullyQualifiedName())
+	}
+
+	for name, data := range map[string][]byte{
+		"invalid": []byte("not a descriptor set"),
+		"empty":   nil,
+	} {
+		_, err = ParseDescriptorSet(data)
+		assert.NotNil(t, err, "Expected an error for %s descriptor set", name)
+	}
+
+	missing := proto.Clone(files[0].AsFileDescriptorProto()).(*descriptor.FileDescriptorProto)
+	missing.Dependency = append(missing.Dependency, "missing.proto")
+	data, err = proto.Marshal(&descriptor.FileDescriptorSet{File: []*descriptor.FileDescriptorProto{missing}})
+	assert.Nil(t, err, "Cannot marshal descriptor set")
+	_, err = ParseDescriptorSet(data)
+	if assert.NotNil(t, err, "Expected an error for a missing import") {
+		assert.Contains(t, err.Error(), "missing.proto")
+	}
+
+	assert.True(t, IsDescriptorSet("dir/echo.PB"))
+	assert.True(t, IsDescriptorSet("echo.protoset"))
+	assert.False(t, IsDescriptorSet("echo.proto"))
+}
+
+func (suite *SchemaTestSuite) TestFileContent() {
+	t := suite.T()
+
+	for content, expected := range map[string]string{
+		"syntax = \"proto3\";":                           "syntax = \"proto3\";",
+		"data:application/octet-stream;base64,AAEC":      "\x00\x01\x02",
+		"data:text/plain,syntax%20%3D%20%22proto3%22%3B": "syntax = \"proto3\";",
+	} {
+		data, err := FileContent(content)
+		assert.Nil(t, err, "FileContent error for %q", content)
+		assert.Equal(t, expected, string(data))
+	}
+
+	for _, content := range []string{"data:text/plain", "data:;base64,!"} {
+		_, err := FileContent(content)
+		assert.NotNil(t, err, "Expected an error for %q", content)
+	}
+}
+
+func TestSchemaTestSuite(t *testing.T) {
+	suite.Run(t, new(SchemaTestSuite))
+}
@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The nRPC subjects are derived from the proto declarations and the nrpc options the same way
+// protoc-gen-nrpc does, so that the services are reachable by the clients it generates.
+
+// PackageSubject returns the nRPC subject prefix of the file services. protoc-gen-nrpc only falls
+// back to the proto package when the file has no option at all.
+func PackageSubject(file *desc.FileDescriptor) string {
+	options := file.GetFileOptions()
+	if options == nil {
+		return file.GetPackage()
+	}
+	value, _ := proto.GetExtension(options, nrpc.E_PackageSubject).(string)
+	return value
+}
+
+// PackageSubjectParams returns the names of the nRPC subject parameters following the package
+// subject
+func PackageSubjectParams(file *desc.FileDescriptor) []string {
+	options := file.GetFileOptions()
+	if options == nil {
+		return nil
+	}
+	value, _ := proto.GetExtension(options, nrpc.E_PackageSubjectParams).([]string)
+	return value
+}
+
+// ServiceSubject returns the nRPC subject token of the service
+func ServiceSubject(service *desc.ServiceDescriptor) string {
+	if options := service.GetServiceOptions(); options != nil {
+		if value, _ := proto.GetExtension(options, nrpc.E_ServiceSubject).(string); value != "" {
+			return value
+		}
+	}
+	return applySubjectRule(service.GetFile(), nrpc.E_ServiceSubjectRule, service.GetName())
+}
+
+// ServiceSubjectParams returns the names of the nRPC subject parameters following the service
+// subject
+func ServiceSubjectParams(service *desc.ServiceDescriptor) []string {
+	options := service.GetServiceOptions()
+	if options == nil {
+		return nil
+	}
+	value, _ := proto.GetExtension(options, nrpc.E_ServiceSubjectParams).([]string)
+	return value
+}
+
+// MethodSubject returns the nRPC subject token of the method
+func MethodSubject(method *desc.MethodDescriptor) string {
+	if options := method.GetMethodOptions(); options != nil {
+		if value, _ := proto.GetExtension(options, nrpc.E_MethodSubject).(string); value != "" {
+			return value
+		}
+	}
+	return applySubjectRule(method.GetFile(), nrpc.E_MethodSubjectRule, method.GetName())
+}
+
+// MethodSubjectParams returns the names of the nRPC subject parameters following the method
+// subject
+func MethodSubjectParams(method *desc.MethodDescriptor) []string {
+	options := method.GetMethodOptions()
+	if options == nil {
+		return nil
+	}
+	value, _ := proto.GetExtension(options, nrpc.E_MethodSubjectParams).([]string)
+	return value
+}
+
+// applySubjectRule builds a subject token from name with the file subject rule option
+func applySubjectRule(file *desc.FileDescriptor, rule protoreflect.ExtensionType, name string) string {
+	options := file.GetFileOptions()
+	if options == nil {
+		return name
+	}
+	if value, _ := proto.GetExtension(options, rule).(nrpc.SubjectRule); value == nrpc.SubjectRule_TOLOWER {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// StreamedReply reports whether the method replies with the nrpc streamed reply protocol
+func StreamedReply(method *desc.MethodDescriptor) bool {
+	options := method.GetMethodOptions()
+	if options == nil {
+		return false
+	}
+	value, _ := proto.GetExtension(options, nrpc.E_StreamedReply).(bool)
+	return value
+}
+
+// CamelCase returns the Go name protoc-gen-go generates for a proto name, the services and
+// methods are known to the handlers by these names
+func CamelCase(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	var b []byte
+	i := 0
+	if name[0] == '_' {
+		// Exported names cannot start with an underscore
+		b = append(b, 'X')
+		i++
+	}
+	for ; i < len(name); i++ {
+		c := name[i]
+		if c == '_' && i+1 < len(name) && isASCIILower(name[i+1]) {
+			continue
+		}
+		if isASCIIDigit(c) {
+			b = append(b, c)
+			continue
+		}
+		if isASCIILower(c) {
+			c ^= ' '
+		}
+		b = append(b, c)
+
+		// Lower case letters following a word start are kept
+		for i+1 < len(name) && isASCIILower(name[i+1]) {
+			i++
+			b = append(b, name[i])
+		}
+	}
+	return string(b)
+}
+
+func isASCIILower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isASCIIDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -1,6 +1,7 @@
 package nrpc
 
 import (
+	"strings"
 
 	//used for generated stub files
 
@@ -10,14 +11,42 @@ import (
 
 // ServiceInfo holds name of service and name of proto
 type ServiceInfo struct {
-	ServiceName string
-	ProtoName   string
+	ServiceName    string
+	ProtoName      string
+	PackageSubject string   // nRPC subject prefix of the proto package, may be empty
+	ServiceSubject string   // nRPC subject of the service, ServiceName when empty
+	PackageParams  []string // Names of the nRPC subject parameters following the package subject
+	ServiceParams  []string // Names of the nRPC subject parameters following the service subject
+}
+
+func (s *ServiceInfo) serviceSubject() string {
+	if s.ServiceSubject != "" {
+		return s.ServiceSubject
+	}
+	return s.ServiceName
+}
+
+// subject returns the nRPC subject the calls of the service methods are published under, the
+// subject parameters are wildcards
+func (s *ServiceInfo) subject() string {
+	var tokens []string
+	if s.PackageSubject != "" {
+		tokens = append(tokens, s.PackageSubject)
+	}
+	for range s.PackageParams {
+		tokens = append(tokens, "*")
+	}
+	tokens = append(tokens, s.serviceSubject())
+	for range s.ServiceParams {
+		tokens = append(tokens, "*")
+	}
+	return strings.Join(tokens, ".")
 }
 
 // ServerService methods to invoke registartion of service
 type ServerService interface {
 	ServiceInfo() *ServiceInfo
-	RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler)
+	RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler) error
 }
 
 // ServiceRegistery holds all the server services written in proto file
@@ -0,0 +1,425 @@
+package nrpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// TimeoutHeader is the NATS header carrying how long the caller waits for the reply of an nRPC
+// call, either a duration such as 1.5s or a number of milliseconds
+const TimeoutHeader = "Nrpc-Timeout"
+
+// Method is an nRPC method of a service served by the trigger
+type Method struct {
+	Name       string // Method name the calls are dispatched to the handlers with
+	Subject    string // nRPC subject token of the method, Name when empty
+	NewRequest func() proto.Message
+	NewReply   func() proto.Message
+
+	// SubjectParams are the names of the nRPC subject parameters following the method subject
+	SubjectParams []string
+
+	// ServerStream methods reply with the nrpc streamed reply protocol, see ReplyStream
+	ServerStream bool
+	// ClientStream methods receive a stream of request messages, see ClientStream
+	ClientStream bool
+}
+
+func (m *Method) subject() string {
+	if m.Subject != "" {
+		return m.Subject
+	}
+	return m.Name
+}
+
+// Serve subscribes the nRPC subject of the service and dispatches the calls of its methods to the
+// trigger handlers, the flow replies are sent back to the nRPC clients. The subject is subscribed
+// on every connection of the trigger pool in the queue group of the service, so that the calls
+// are spread across the connections. It is called by the generated RunRegisterServerService of
+// each service. The request messages following the first one of a client stream are received on
+// a subject of the instance, see StreamSubjectHeader.
+func (h *Handler) Serve(t *Trigger, service *ServiceInfo, methods ...Method) error {
+	// The subjects of the service are namespaced by the subject prefix
+	prefix, err := h.triggerSettings.subjectPrefix()
+	if err != nil {
+		return err
+	}
+	if prefix != "" {
+		prefixed := *service
+		prefixed.PackageSubject = PrefixSubject(prefix, service.PackageSubject)
+		service = &prefixed
+	}
+
+	queue := h.triggerSettings.queueGroup(service)
+	clientStream := false
+	methodsBySubject := make(map[string]*Method, len(methods))
+	for i := range methods {
+		methodsBySubject[methods[i].subject()] = &methods[i]
+		clientStream = clientStream || methods[i].ClientStream
+	}
+
+	// The durable consumer is subscribed once, on the handler connection
+	conns := t.natsConns
+	if h.triggerSettings.EnableStreaming || len(conns) == 0 {
+		conns = []*nats.Conn{h.natsConn}
+	}
+
+	// The request messages following the first one of a client stream are received on a subject
+	// of the instance, the queue group would spread them across the instances
+	streams := newCallStreams()
+	if clientStream && !h.triggerSettings.EnableStreaming {
+		if !h.natsConn.HeadersSupported() {
+			t.logger.Warnf("The stream messages of %s are load-balanced by the queue group [%s] without NATS headers support, serve its client streams from a single instance",
+				service.ServiceName, queue)
+		} else {
+			streams.subject = nats.NewInbox()
+			_, err = h.queueSubscribe(h.natsConn, streams.subject, "", func(msg *nats.Msg) {
+				t.serveStreamSubjectMsg(streams, msg)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The instances of the app share the calls
+	for _, nc := range conns {
+		nc := nc
+		_, err = h.queueSubscribe(nc, service.subject()+".>", queue, func(msg *nats.Msg) {
+			// The flows serving the call are canceled at the deadline of the caller
+			ctx, cancel := requestContext(msg)
+			request := nrpc.NewRequest(ctx, nc, msg.Subject, msg.Reply)
+			request.Encoding = "protobuf"
+			method, replyErr := parseMethod(service, methodsBySubject, request)
+
+			// The messages of a client stream are queued in order
+			if replyErr == nil && method.ClientStream {
+				t.serveStreamMsg(h, streams, service, method, request, cancel, msg)
+				return
+			}
+
+			serve := func() {
+				defer cancel()
+				t.serveMsg(service, method, request, replyErr, msg.Data)
+			}
+
+			// Durable requests are acknowledged once served
+			if h.triggerSettings.EnableStreaming {
+				serve()
+				return
+			}
+			h.serveAsync(serve)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefixSubject returns subject namespaced by the subjectPrefix setting of a trigger, the generated
+// clients call the services of the trigger on the prefixed subjects
+func PrefixSubject(prefix, subject string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), ".")
+	switch {
+	case prefix == "":
+		return subject
+	case subject == "":
+		return prefix
+	}
+	return prefix + "." + subject
+}
+
+// headersContextKey is the context key of the NATS headers of the request message of a call
+type headersContextKey struct{}
+
+// deliveryContextKey is the context key of the JetStream delivery of a durable request
+type deliveryContextKey struct{}
+
+// requestContext returns the context of the nRPC call of msg, with the headers of msg and the
+// deadline of the caller when msg carries a valid TimeoutHeader. The JetStream delivery of a
+// durable request is moved from its headers to the context.
+func requestContext(msg *nats.Msg) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if key := msg.Header.Get(deliveryHeader); key != "" {
+		ctx = context.WithValue(ctx, deliveryContextKey{}, key)
+		msg.Header.Del(deliveryHeader)
+	}
+	ctx = context.WithValue(ctx, headersContextKey{}, msg.Header)
+	if timeout := callerTimeout(msg); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// requestHeaders returns the NATS headers of the request message of the call, the first value of
+// each header
+func requestHeaders(ctx context.Context) map[string]string {
+	header, _ := ctx.Value(headersContextKey{}).(nats.Header)
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return headers
+}
+
+// requestMetadata returns the metadata of the nRPC call, empty when ctx is not the context of an
+// nRPC request. The subject parameters are given by kind.
+func requestMetadata(ctx context.Context) map[string]interface{} {
+	request := nrpc.GetRequest(ctx)
+	if request == nil {
+		return map[string]interface{}{}
+	}
+
+	methodParams, _ := ctx.Value(methodParamsContextKey{}).(map[string]string)
+	metadata := map[string]interface{}{
+		"subject":       request.Subject,
+		"replySubject":  request.ReplySubject,
+		"methodName":    request.MethodName,
+		"encoding":      request.Encoding,
+		"packageParams": paramsMap(request.PackageParams),
+		"serviceParams": paramsMap(request.ServiceParams),
+		"methodParams":  paramsMap(methodParams),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		metadata["deadline"] = deadline
+	}
+	return metadata
+}
+
+// methodParamsContextKey is the context key of the method subject parameters of a call
+type methodParamsContextKey struct{}
+
+// subjectParams returns the values of the subject parameters by name
+func subjectParams(names []string, values []string) map[string]string {
+	params := make(map[string]string, len(names))
+	for i, name := range names {
+		params[name] = values[i]
+	}
+	return params
+}
+
+// requestParams returns the subject parameters of the nRPC call by name, the method parameters
+// override the service parameters which override the package parameters
+func requestParams(ctx context.Context) map[string]string {
+	params := make(map[string]string)
+	request := nrpc.GetRequest(ctx)
+	if request == nil {
+		return params
+	}
+
+	methodParams, _ := ctx.Value(methodParamsContextKey{}).(map[string]string)
+	for _, values := range []map[string]string{request.PackageParams, request.ServiceParams, methodParams} {
+		for name, value := range values {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+// paramsMap returns the nrpc subject parameters as flow data
+func paramsMap(params map[string]string) map[string]interface{} {
+	values := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		values[key] = value
+	}
+	return values
+}
+
+// callerTimeout returns the TimeoutHeader of msg, zero when unset or invalid
+func callerTimeout(msg *nats.Msg) time.Duration {
+	value := msg.Header.Get(TimeoutHeader)
+	if value == "" {
+		return 0
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// serveAsync runs serve in its own goroutine so that the calls received on a subscription are
+// processed concurrently by the handler workers
+func (h *Handler) serveAsync(serve func()) {
+	h.mutex.RLock()
+	if h.closing {
+		h.mutex.RUnlock()
+		serve() // Replied unavailable straight away
+		return
+	}
+	h.requestsRunning.Add(1)
+	h.mutex.RUnlock()
+
+	go func() {
+		defer h.requestsRunning.Done()
+		serve()
+	}()
+}
+
+// serveMsg serves a single nRPC call of the service and replies to it, replyErr is the error
+// parsing the method called
+func (t *Trigger) serveMsg(service *ServiceInfo, method *Method, request *nrpc.Request, replyErr *nrpc.Error, data []byte) {
+	var (
+		resp, req proto.Message
+		headers   map[string]string // Reply headers set by the flow
+	)
+	if replyErr == nil {
+		req, replyErr = decodeRequest(method, request, data)
+	}
+
+	if replyErr != nil {
+		t.logger.Warnf("Invalid nRPC call on subject [%s]: %v", request.Subject, replyErr.Message)
+	} else if method.ServerStream {
+		startStreamedReply(request)
+		defer request.StreamCancel()
+
+		request.Handler = func(ctx context.Context) (proto.Message, error) {
+			return nil, t.dispatchStream(ctx, service, method, request.Subject, req, request)
+		}
+		_, replyErr = request.Run()
+	} else {
+		request.Handler = func(ctx context.Context) (proto.Message, error) {
+			resp, reply, err := t.dispatchMethod(ctx, service, method, request.Subject, req)
+			if reply != nil {
+				headers = reply.Headers
+			}
+			return resp, err
+		}
+		resp, replyErr = request.Run()
+	}
+
+	// The caller of a failed durable request is replied by its last delivery
+	if replyErr != nil && t.deliveries.redelivered(request.Context) {
+		t.logger.Debugf("Skipping the reply to nRPC call on subject [%s], the request is redelivered: %v", request.Subject, replyErr.Message)
+		return
+	}
+
+	if err := t.sendReply(request, resp, replyErr, headers); err != nil {
+		t.logger.Errorf("Reply to nRPC call on subject [%s] failed: %v", request.Subject, err)
+	}
+}
+
+// sendReply replies to a call which is not streamed, with the NATS headers set by the flow. The
+// reply is sent without the headers when the NATS server does not support them.
+func (t *Trigger) sendReply(request *nrpc.Request, resp proto.Message, replyErr *nrpc.Error, headers map[string]string) error {
+	nc, ok := request.Conn.(*nats.Conn)
+	if len(headers) == 0 || !ok || request.StreamedReply() {
+		return request.SendReply(resp, replyErr)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if replyErr != nil {
+		data, err = nrpc.MarshalErrorResponse(request.Encoding, replyErr)
+	} else {
+		data, err = nrpc.Marshal(request.Encoding, resp)
+	}
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(request.ReplySubject)
+	msg.Data = data
+	for key, value := range headers {
+		msg.Header.Set(key, value)
+	}
+
+	err = nc.PublishMsg(msg)
+	if err == nats.ErrHeadersNotSupported {
+		t.logger.Warnf("Replying to nRPC call on subject [%s] without headers, not supported by the NATS server", request.Subject)
+		return request.SendReply(resp, replyErr)
+	}
+	return err
+}
+
+// parseMethod returns the method called by the nRPC request and sets the request encoding and
+// subject parameters
+func parseMethod(service *ServiceInfo, methods map[string]*Method, request *nrpc.Request) (*Method, *nrpc.Error) {
+	packageParams, serviceParams, methodName, tail, err := nrpc.ParseSubject(
+		service.PackageSubject, len(service.PackageParams), service.serviceSubject(), len(service.ServiceParams), request.Subject)
+	if err != nil {
+		return nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: err.Error()}
+	}
+	request.MethodName, request.SubjectTail = methodName, tail
+	request.PackageParams = subjectParams(service.PackageParams, packageParams)
+	request.ServiceParams = subjectParams(service.ServiceParams, serviceParams)
+
+	method, ok := methods[request.MethodName]
+	if !ok {
+		return nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "unknown name: " + request.MethodName}
+	}
+
+	methodParams, encoding, err := nrpc.ParseSubjectTail(len(method.SubjectParams), request.SubjectTail)
+	if err != nil {
+		return nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: err.Error()}
+	}
+	request.Context = context.WithValue(request.Context, methodParamsContextKey{}, subjectParams(method.SubjectParams, methodParams))
+	if encoding != "protobuf" && encoding != "json" {
+		// The error is replied with the default encoding
+		return nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "unsupported encoding: " + encoding}
+	}
+	request.Encoding = encoding
+
+	return method, nil
+}
+
+// decodeRequest decodes a request message of the method
+func decodeRequest(method *Method, request *nrpc.Request, data []byte) (proto.Message, *nrpc.Error) {
+	req := method.NewRequest()
+	if err := nrpc.Unmarshal(request.Encoding, data, req); err != nil {
+		return nil, &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "bad request received: " + err.Error()}
+	}
+	return req, nil
+}
+
+// dispatchMethod dispatches the call to the trigger handlers and converts the flow reply data into
+// the reply message of the method. Flow errors are returned as the nRPC errors they map to, with
+// the flow reply when the flow replied an error code.
+func (t *Trigger) dispatchMethod(ctx context.Context, service *ServiceInfo, method *Method, subject string, req proto.Message) (proto.Message, *Reply, error) {
+	reply, err := t.Dispatch(ctx, map[string]interface{}{
+		"serviceName": service.ServiceName,
+		"methodName":  method.Name,
+		"subject":     subject,
+		"reqData":     req,
+	})
+	if err != nil {
+		return nil, reply, toNrpcError(err)
+	}
+	resp, err := toReplyMessage(service, method, reply.Data)
+	return resp, reply, err
+}
+
+// toReplyMessage converts flow reply data into a reply message of the method
+func toReplyMessage(service *ServiceInfo, method *Method, data interface{}) (proto.Message, error) {
+	resp := method.NewReply()
+	if err := setMessage(resp, data); err != nil {
+		return nil, &nrpc.Error{
+			Type:    nrpc.Error_SERVER,
+			Message: fmt.Sprintf("invalid reply data for %s.%s: %v", service.ServiceName, method.Name, err),
+		}
+	}
+	return resp, nil
+}
+
+// toNrpcError returns the error replied to the nRPC client, flow errors are server errors
+func toNrpcError(err error) *nrpc.Error {
+	if nrpcErr, ok := err.(*nrpc.Error); ok {
+		return nrpcErr
+	}
+	return &nrpc.Error{Type: nrpc.Error_SERVER, Message: err.Error()}
+}
@@ -0,0 +1,848 @@
+package nrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	jsserverTest "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type ServiceTestSuite struct {
+	suite.Suite
+}
+
+// testProtoService serves the Echo, Other, server-streaming List, client-streaming Join and
+// bidirectional Chat methods of test.EchoService with Handler.Serve, as the generated support
+// files do
+type testProtoService struct {
+	serviceInfo *ServiceInfo
+}
+
+func (s *testProtoService) ServiceInfo() *ServiceInfo {
+	return s.serviceInfo
+}
+
+func (s *testProtoService) RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler) error {
+	newStringValue := func() proto.Message { return &wrapperspb.StringValue{} }
+	return h.Serve(t, s.serviceInfo,
+		Method{Name: "Echo", NewRequest: newStringValue, NewReply: newStringValue},
+		Method{Name: "Other", Subject: "other", NewRequest: newStringValue, NewReply: newStringValue},
+		Method{Name: "List", NewRequest: newStringValue, NewReply: newStringValue, ServerStream: true},
+		Method{Name: "Join", NewRequest: newStringValue, NewReply: newStringValue, ClientStream: true},
+		Method{Name: "Chat", NewRequest: newStringValue, NewReply: newStringValue, ClientStream: true, ServerStream: true},
+	)
+}
+
+func startTestProtoTrigger(t *testing.T, settings map[string]interface{}, handlers ...trigger.Handler) trigger.Trigger {
+	return startTestTriggerService(t, &testProtoService{
+		serviceInfo: &ServiceInfo{ProtoName: "echo", ServiceName: "EchoService", PackageSubject: "test"},
+	}, settings, handlers...)
+}
+
+func (suite *ServiceTestSuite) TestServe() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"}, ""),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for _, encoding := range []string{"protobuf", "json"} {
+		resp := &wrapperspb.StringValue{}
+		err = nrpc.Call(&wrapperspb.StringValue{Value: "hello " + encoding}, resp, nc, "test.EchoService.Echo", encoding, time.Second)
+		assert.Nil(t, err, "Call error with %s encoding", encoding)
+		assert.Equal(t, "hello "+encoding, resp.Value)
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeQueueGroup() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	const calls = 20
+
+	// Each trigger counts the calls its flows serve, the triggers of different queue groups both
+	// receive every call
+	for name, queueGroups := range map[string][]string{"default": {"", ""}, "distinct": {"app1", "app2"}} {
+		var counts [2]int32
+		var triggers []trigger.Trigger
+		for i, queueGroup := range queueGroups {
+			count := &counts[i]
+			triggers = append(triggers, startTestProtoTrigger(t, map[string]interface{}{"queueGroup": queueGroup},
+				&testTriggerHandler{
+					settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+					handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+						atomic.AddInt32(count, 1)
+						return map[string]interface{}{"data": triggerData.(*Output).ProtobufRequestMap}, nil
+					},
+				},
+			))
+		}
+
+		for i := 0; i < calls; i++ {
+			resp := &wrapperspb.StringValue{}
+			err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "test.EchoService.Echo", "protobuf", time.Second)
+			assert.Nil(t, err, "Call error with %s queue groups", name)
+		}
+
+		served := func() int32 { return atomic.LoadInt32(&counts[0]) + atomic.LoadInt32(&counts[1]) }
+		if name == "default" {
+			assert.Equal(t, int32(calls), served(), "Each call is served once")
+			assert.NotZero(t, atomic.LoadInt32(&counts[0]), "The calls are load-balanced")
+			assert.NotZero(t, atomic.LoadInt32(&counts[1]), "The calls are load-balanced")
+		} else {
+			assert.Eventually(t, func() bool { return served() == 2*calls }, time.Second, 10*time.Millisecond,
+				"Each call is served by both triggers, served %d", served())
+		}
+
+		for _, trg := range triggers {
+			assert.Nil(t, trg.Stop(), "Stop error")
+		}
+		delete(ServiceRegistery.ServerServices, "echoEchoService")
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeQueueGroupClientStream() {
+	t := suite.T()
+
+	// The stream subject is sent with a NATS header
+	s := jsserverTest.RunServer(&jsserverTest.DefaultTestOptions)
+	defer s.Shutdown()
+
+	// Each trigger counts the Join calls its flows serve, Chat replies with the sequence of each
+	// request message in its call
+	var counts [2]int32
+	for i := range counts {
+		count := &counts[i]
+		trg := startTestProtoTrigger(t, map[string]interface{}{},
+			&testTriggerHandler{
+				settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Join"},
+				handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+					atomic.AddInt32(count, 1)
+					var values []string
+					messages, _ := triggerData.(*Output).ProtobufRequestMap["messages"].([]interface{})
+					for _, msg := range messages {
+						values = append(values, msg.(map[string]interface{})["value"].(string))
+					}
+					return map[string]interface{}{"data": map[string]interface{}{"value": strings.Join(values, ",")}}, nil
+				},
+			},
+			&testTriggerHandler{
+				settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Chat"},
+				handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+					out := triggerData.(*Output)
+					value := fmt.Sprintf("%s:%v", out.ProtobufRequestMap["value"], out.NrpcData["streamSeq"])
+					return map[string]interface{}{"data": map[string]interface{}{"value": value}}, nil
+				},
+			},
+		)
+		defer trg.Stop()
+	}
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// All the messages of a call reach the instance serving its first message
+	for i := 0; i < 20; i++ {
+		value, err := joinCall(nc, "protobuf", "a", "b", "c", "d", "e")
+		assert.Nil(t, err, "Join error")
+		assert.Equal(t, "a,b,c,d,e", value)
+	}
+	assert.Equal(t, int32(20), atomic.LoadInt32(&counts[0])+atomic.LoadInt32(&counts[1]), "Each call is served once")
+	assert.NotZero(t, atomic.LoadInt32(&counts[0]), "The calls are load-balanced")
+	assert.NotZero(t, atomic.LoadInt32(&counts[1]), "The calls are load-balanced")
+
+	for i := 0; i < 5; i++ {
+		stream, err := NewClientStream(context.Background(), nc, "test.EchoService.Chat", "protobuf", time.Second)
+		assert.Nil(t, err, "NewClientStream error")
+
+		for seq, value := range []string{"a", "b", "c"} {
+			assert.Nil(t, stream.Send(&wrapperspb.StringValue{Value: value}), "Send error")
+
+			resp := &wrapperspb.StringValue{}
+			assert.Nil(t, stream.Recv(resp), "Recv error")
+			assert.Equal(t, fmt.Sprintf("%s:%d", value, seq+1), resp.Value)
+		}
+
+		// The replies are only read by the stream call subscription once the stream subject is known
+		assert.False(t, stream.routeSub.IsValid(), "The stream subject subscription should be removed")
+		assert.Nil(t, stream.CloseSend(), "CloseSend error")
+		assert.Equal(t, io.EOF, stream.Recv(&wrapperspb.StringValue{}))
+		stream.Close()
+	}
+}
+
+func (suite *ServiceTestSuite) TestClientStreamWithoutStreamSubject() {
+	t := suite.T()
+
+	s := jsserverTest.RunServer(&jsserverTest.DefaultTestOptions)
+	defer s.Shutdown()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// A server which does not send the stream subject receives the first message only
+	received := make(chan *nats.Msg, 10)
+	_, err = nc.ChanSubscribe("test.EchoService.Join", received)
+	assert.Nil(t, err, "Cannot subscribe")
+
+	stream, err := NewClientStream(context.Background(), nc, "test.EchoService.Join", "protobuf", 5*time.Second)
+	assert.Nil(t, err, "NewClientStream error")
+	defer stream.Close()
+
+	assert.Nil(t, stream.Send(&wrapperspb.StringValue{Value: "a"}), "Send error")
+	start := time.Now()
+	err = stream.Send(&wrapperspb.StringValue{Value: "b"})
+	if assert.NotNil(t, err, "Send error expected without stream subject") {
+		assert.Contains(t, err.Error(), "No stream subject received")
+	}
+	assert.Less(t, int64(time.Since(start)), int64(streamSubjectWait+500*time.Millisecond), "The wait should be bounded")
+	assert.Len(t, received, 1, "Only the first message should be sent to the method subject")
+}
+
+func (suite *ServiceTestSuite) TestServeSubjectPrefix() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	os.Setenv("NRPC_TEST_SUBJECT_PREFIX", "dev.alice")
+	defer os.Unsetenv("NRPC_TEST_SUBJECT_PREFIX")
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{"subjectPrefix": "=$env[NRPC_TEST_SUBJECT_PREFIX]"},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"}, ""),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	resp := &wrapperspb.StringValue{}
+	err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "dev.alice.test.EchoService.Echo", "protobuf", time.Second)
+	assert.Nil(t, err, "Call error")
+	assert.Equal(t, "hello", resp.Value)
+
+	// The subjects without the prefix are not served
+	err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "test.EchoService.Echo", "protobuf", 100*time.Millisecond)
+	assert.NotNil(t, err, "Expected no reply without the subject prefix")
+}
+
+func (suite *ServiceTestSuite) TestServeConnectionPool() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{"natsConnPoolSize": 3},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"}, ""),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for i := 0; i < 30; i++ {
+		resp := &wrapperspb.StringValue{}
+		err = nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, resp, nc, "test.EchoService.Echo", "protobuf", time.Second)
+		assert.Nil(t, err, "Call error")
+	}
+
+	// The single service is subscribed on every connection of the pool, which all serve calls
+	natsTrigger := trg.(*Trigger)
+	if assert.Len(t, natsTrigger.natsConns, 3) {
+		for i, conn := range natsTrigger.natsConns {
+			assert.Equal(t, 1, conn.NumSubscriptions(), "Subscriptions of connection %d", i)
+			assert.NotZero(t, conn.Stats().InMsgs, "Calls received on connection %d", i)
+		}
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeErrors() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				return nil, errors.New("flow failed")
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	call := func(subject string) *nrpc.Error {
+		err := nrpc.Call(&wrapperspb.StringValue{Value: "hello"}, &wrapperspb.StringValue{}, nc, subject, "protobuf", time.Second)
+		nrpcErr, ok := err.(*nrpc.Error)
+		if !ok {
+			assert.Fail(t, "Expected an nRPC error", "Subject %s, got %v", subject, err)
+			return &nrpc.Error{}
+		}
+		return nrpcErr
+	}
+
+	nrpcErr := call("test.EchoService.Echo")
+	assert.Equal(t, nrpc.Error_SERVER, nrpcErr.Type)
+	assert.Equal(t, "flow failed", nrpcErr.Message)
+
+	// Other is served but no handler is bound to it
+	nrpcErr = call("test.EchoService.other")
+	assert.Equal(t, nrpc.Error_CLIENT, nrpcErr.Type)
+	assert.Equal(t, "unimplemented method: EchoService.Other", nrpcErr.Message)
+
+	nrpcErr = call("test.EchoService.Missing")
+	assert.Equal(t, nrpc.Error_CLIENT, nrpcErr.Type)
+	assert.Equal(t, "unknown name: Missing", nrpcErr.Message)
+
+	// Invalid requests are rejected before reaching a flow
+	for subject, data := range map[string][]byte{
+		"test.EchoService.Echo":     {0xff},
+		"test.EchoService.Echo.xml": {},
+	} {
+		msg, err := nc.Request(subject, data, time.Second)
+		if assert.Nil(t, err, "Request error on %s", subject) {
+			err = nrpc.UnmarshalResponse("protobuf", msg.Data, &wrapperspb.StringValue{})
+			if assert.IsType(t, &nrpc.Error{}, err, "Reply to %s", subject) {
+				assert.Equal(t, nrpc.Error_CLIENT, err.(*nrpc.Error).Type)
+			}
+		}
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeReplyErrors() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				switch triggerData.(*Output).ProtobufRequestMap["value"] {
+				case "missing":
+					return map[string]interface{}{"code": 404, "message": "user not found", "details": map[string]interface{}{"id": "42"}}, nil
+				case "busy":
+					return map[string]interface{}{"code": 503}, nil
+				case "throw":
+					return nil, activity.NewError("invalid user", "CLIENT", nil)
+				}
+				return map[string]interface{}{"code": 200, "data": map[string]interface{}{"value": "ok"}}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for value, expected := range map[string]*ReplyError{
+		"missing": {Type: nrpc.Error_CLIENT, Message: "user not found", Details: map[string]interface{}{"id": "42"}},
+		"busy":    {Type: nrpc.Error_SERVERTOOBUSY, Message: "flow replied with code 503"},
+		"throw":   {Type: nrpc.Error_CLIENT, Message: "invalid user"},
+	} {
+		err := nrpc.Call(&wrapperspb.StringValue{Value: value}, &wrapperspb.StringValue{}, nc, "test.EchoService.Echo", "protobuf", time.Second)
+		replyErr, ok := ParseReplyError(err)
+		if assert.True(t, ok, "Expected a reply error for %s, got %v", value, err) {
+			assert.Equal(t, expected, replyErr)
+		}
+	}
+
+	resp := &wrapperspb.StringValue{}
+	err = nrpc.Call(&wrapperspb.StringValue{Value: "found"}, resp, nc, "test.EchoService.Echo", "protobuf", time.Second)
+	assert.Nil(t, err, "2xx codes are success codes")
+	assert.Equal(t, "ok", resp.Value)
+
+	// Transport failures are not reply errors
+	err = nrpc.Call(&wrapperspb.StringValue{}, &wrapperspb.StringValue{}, nc, "test.MissingService.Echo", "protobuf", 100*time.Millisecond)
+	_, ok := ParseReplyError(err)
+	assert.False(t, ok, "Expected a transport failure, got %v", err)
+}
+
+func (suite *ServiceTestSuite) TestServeDeadline() {
+	t := suite.T()
+
+	// Headers are supported from NATS server v2.2
+	s := jsserverTest.RunServer(&jsserverTest.DefaultTestOptions)
+	defer s.Shutdown()
+
+	deadlines := make(chan time.Duration, 1)
+	canceled := make(chan error, 1)
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo", "timeout": 100},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				deadline, _ := ctx.Deadline()
+				deadlines <- time.Until(deadline)
+
+				// The flow overruns the deadline
+				select {
+				case <-ctx.Done():
+					canceled <- ctx.Err()
+				case <-time.After(2 * time.Second):
+					canceled <- nil
+				}
+				return map[string]interface{}{"data": map[string]interface{}{"value": "late"}}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	data, err := proto.Marshal(&wrapperspb.StringValue{Value: "hello"})
+	assert.Nil(t, err, "Cannot marshal request")
+
+	// The caller deadline wins over the handler timeout
+	for timeout, expected := range map[string]time.Duration{"": 100 * time.Millisecond, "300": 300 * time.Millisecond, "0.5s": 500 * time.Millisecond} {
+		msg := nats.NewMsg("test.EchoService.Echo")
+		msg.Data = data
+		if timeout != "" {
+			msg.Header.Set(TimeoutHeader, timeout)
+		}
+
+		start := time.Now()
+		reply, err := nc.RequestMsg(msg, 2*time.Second)
+		if !assert.Nil(t, err, "Request error with timeout %q", timeout) {
+			continue
+		}
+		err = nrpc.UnmarshalResponse("protobuf", reply.Data, &wrapperspb.StringValue{})
+		if assert.NotNil(t, err, "Expected a timeout reply with timeout %q", timeout) {
+			assert.Equal(t, newTimeoutError(context.DeadlineExceeded).Error(), err.Error())
+		}
+		assert.Less(t, int64(time.Since(start)), int64(expected+time.Second), "Replied at the deadline")
+
+		deadline := <-deadlines
+		assert.True(t, deadline > expected-50*time.Millisecond && deadline <= expected, "Flow deadline %v with timeout %q", deadline, timeout)
+		assert.Equal(t, context.DeadlineExceeded, <-canceled, "The flow context is canceled at the deadline")
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeHeaders() {
+	t := suite.T()
+
+	s := jsserverTest.RunServer(&jsserverTest.DefaultTestOptions)
+	defer s.Shutdown()
+
+	outputs := make(chan *Output, 1)
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				output := triggerData.(*Output)
+				outputs <- output
+				return map[string]interface{}{
+					"data":    map[string]interface{}{"value": "hello"},
+					"headers": map[string]interface{}{"Trace-Id": output.Headers["Trace-Id"], "Served-By": "flow"},
+				}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	data, err := proto.Marshal(&wrapperspb.StringValue{Value: "hello"})
+	assert.Nil(t, err, "Cannot marshal request")
+
+	msg := nats.NewMsg("test.EchoService.Echo")
+	msg.Data = data
+	msg.Header.Set("Trace-Id", "abc")
+	msg.Header.Add("Trace-Id", "def")
+	reply, err := nc.RequestMsg(msg, 2*time.Second)
+	if !assert.Nil(t, err, "Request error") {
+		return
+	}
+
+	resp := &wrapperspb.StringValue{}
+	assert.Nil(t, nrpc.UnmarshalResponse("protobuf", reply.Data, resp), "Unexpected reply error")
+	assert.Equal(t, "hello", resp.GetValue())
+	assert.Equal(t, "abc", reply.Header.Get("Trace-Id"))
+	assert.Equal(t, "flow", reply.Header.Get("Served-By"))
+
+	output := <-outputs
+	assert.Equal(t, map[string]string{"Trace-Id": "abc"}, output.Headers)
+	assert.Equal(t, "test.EchoService.Echo", output.Metadata["subject"])
+	assert.True(t, strings.HasPrefix(output.Metadata["replySubject"].(string), nats.InboxPrefix), "Reply subject %v", output.Metadata["replySubject"])
+	assert.Equal(t, "Echo", output.Metadata["methodName"])
+	assert.Equal(t, "protobuf", output.Metadata["encoding"])
+	assert.NotContains(t, output.Metadata, "deadline")
+}
+
+func (suite *ServiceTestSuite) TestCallerTimeout() {
+	t := suite.T()
+
+	for value, expected := range map[string]time.Duration{
+		"":      0,
+		"250":   250 * time.Millisecond,
+		"1.5s":  1500 * time.Millisecond,
+		"soon":  0,
+		"-1s":   -time.Second,
+		"100ms": 100 * time.Millisecond,
+	} {
+		msg := nats.NewMsg("test.EchoService.Echo")
+		msg.Header.Set(TimeoutHeader, value)
+		assert.Equal(t, expected, callerTimeout(msg), "Timeout of %q", value)
+	}
+	assert.Equal(t, time.Duration(0), callerTimeout(&nats.Msg{}), "No header")
+}
+
+func (suite *ServiceTestSuite) TestServeGracefulStop() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	started := make(chan bool, 1)
+	release := make(chan bool)
+	defer close(release)
+	trg := startTestProtoTrigger(t, map[string]interface{}{"shutdownTimeout": 1},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Echo"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				started <- true
+				<-release // The flow ignores the cancellation
+				return map[string]interface{}{"data": triggerData.(*Output).ProtobufRequestMap}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	replied := make(chan error, 1)
+	go func() {
+		replied <- nrpc.Call(&wrapperspb.StringValue{Value: "slow"}, &wrapperspb.StringValue{}, nc, "test.EchoService.Echo", "protobuf", 5*time.Second)
+	}()
+	<-started
+
+	// The call served in its own goroutine is replied unavailable before the connection is drained
+	start := time.Now()
+	assert.Nil(t, trg.Stop(), "Stop error")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second+2*shutdownGrace+200*time.Millisecond), "Stop overran the shutdown timeout")
+	if err := <-replied; assert.NotNil(t, err, "Expected an unavailable reply") {
+		assert.Equal(t, newUnavailableError().Error(), err.Error())
+	}
+
+	// Stopping again is harmless
+	assert.NotPanics(t, func() { _ = trg.Stop() })
+}
+
+func (suite *ServiceTestSuite) TestServeConcurrently() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	// Both calls must reach a worker before any of them can reply
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	trg := startTestProtoTrigger(t, map[string]interface{}{"workerPoolSize": 2},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				arrived.Done()
+				arrived.Wait()
+				return map[string]interface{}{"data": triggerData.(*Output).ProtobufRequestMap}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	var calls sync.WaitGroup
+	for _, value := range []string{"first", "second"} {
+		calls.Add(1)
+		go func(value string) {
+			defer calls.Done()
+			resp := &wrapperspb.StringValue{}
+			err := nrpc.Call(&wrapperspb.StringValue{Value: value}, resp, nc, "test.EchoService.Echo", "protobuf", 2*time.Second)
+			assert.Nil(t, err, "Call error")
+			assert.Equal(t, value, resp.Value)
+		}(value)
+	}
+	calls.Wait()
+}
+
+// newListTriggerHandler returns a handler streaming the comma separated items of the List requests,
+// "push" items are sent through the reply stream and a "fail" item fails the flow
+func newListTriggerHandler() *testTriggerHandler {
+	return &testTriggerHandler{
+		settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "List"},
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			out := triggerData.(*Output)
+			stream := out.NrpcData["replyStream"].(*ReplyStream)
+
+			var items []interface{}
+			value, _ := out.ProtobufRequestMap["value"].(string)
+			for _, item := range strings.Split(value, ",") {
+				switch item {
+				case "push":
+					if err := stream.Send(map[string]interface{}{"value": item}); err != nil {
+						return nil, err
+					}
+				case "fail":
+					return nil, errors.New("flow failed")
+				default:
+					items = append(items, map[string]interface{}{"value": item})
+				}
+			}
+			return map[string]interface{}{"data": items}, nil
+		},
+	}
+}
+
+// streamCall calls List and returns the streamed values until the end of stream or an error
+func streamCall(nc *nats.Conn, value string) ([]string, error) {
+	sub, err := nrpc.StreamCall(context.Background(), nc, "test.EchoService.List", &wrapperspb.StringValue{Value: value}, "protobuf", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for {
+		resp := &wrapperspb.StringValue{}
+		if err := sub.Next(resp); err != nil {
+			if err == nrpc.ErrEOS {
+				err = nil
+			}
+			return values, err
+		}
+		values = append(values, resp.Value)
+	}
+}
+
+func (suite *ServiceTestSuite) TestServeServerStream() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestProtoTrigger(t, map[string]interface{}{}, newListTriggerHandler())
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	// Array reply data
+	values, err := streamCall(nc, "a,b,c")
+	assert.Nil(t, err, "StreamCall error")
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+
+	// Replies sent by the flow come first
+	values, err = streamCall(nc, "a,push,b,push")
+	assert.Nil(t, err, "StreamCall error")
+	assert.Equal(t, []string{"push", "push", "a", "b"}, values)
+
+	// Flow errors end the stream
+	values, err = streamCall(nc, "push,fail")
+	assert.Equal(t, []string{"push"}, values)
+	if assert.IsType(t, &nrpc.Error{}, err) {
+		assert.Equal(t, nrpc.Error_SERVER, err.(*nrpc.Error).Type)
+		assert.Equal(t, "flow failed", err.(*nrpc.Error).Message)
+	}
+}
+
+// newJoinTriggerHandler returns a handler replying to Join with the comma separated values of the
+// streamed requests, the stream ids are recorded in streamIDs
+func newJoinTriggerHandler(streamIDs chan<- string) *testTriggerHandler {
+	return &testTriggerHandler{
+		settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Join"},
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			out := triggerData.(*Output)
+			streamIDs <- out.NrpcData["streamId"].(string)
+
+			var values []string
+			messages, _ := out.ProtobufRequestMap["messages"].([]interface{})
+			for _, msg := range messages {
+				value, _ := msg.(map[string]interface{})["value"].(string)
+				values = append(values, value)
+			}
+			return map[string]interface{}{"data": map[string]interface{}{"value": strings.Join(values, ",")}}, nil
+		},
+	}
+}
+
+// joinCall calls Join with the values streamed in encoding
+func joinCall(nc *nats.Conn, encoding string, values ...string) (string, error) {
+	stream, err := NewClientStream(context.Background(), nc, "test.EchoService.Join", encoding, time.Second)
+	if err != nil {
+		return "", err
+	}
+	for _, value := range values {
+		if err := stream.Send(&wrapperspb.StringValue{Value: value}); err != nil {
+			return "", err
+		}
+	}
+
+	resp := &wrapperspb.StringValue{}
+	err = stream.CloseAndRecv(resp)
+	return resp.Value, err
+}
+
+func (suite *ServiceTestSuite) TestServeClientStream() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	streamIDs := make(chan string, 10)
+	trg := startTestProtoTrigger(t, map[string]interface{}{}, newJoinTriggerHandler(streamIDs))
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for _, encoding := range []string{"protobuf", "json"} {
+		value, err := joinCall(nc, encoding, "a", "b", "c")
+		assert.Nil(t, err, "Join error with %s encoding", encoding)
+		assert.Equal(t, "a,b,c", value)
+	}
+
+	// An empty stream is a call too
+	value, err := joinCall(nc, "protobuf")
+	assert.Nil(t, err, "Join error")
+	assert.Equal(t, "", value)
+
+	// Each stream has its own id
+	ids := map[string]bool{<-streamIDs: true, <-streamIDs: true, <-streamIDs: true}
+	assert.Len(t, ids, 3)
+	assert.NotContains(t, ids, "")
+
+	// The end of stream counts the messages sent
+	stream, err := NewClientStream(context.Background(), nc, "test.EchoService.Join", "protobuf", time.Second)
+	assert.Nil(t, err, "NewClientStream error")
+	assert.Nil(t, stream.Send(&wrapperspb.StringValue{Value: "a"}))
+	stream.msgCount = 2
+	err = stream.CloseAndRecv(&wrapperspb.StringValue{})
+	if assert.IsType(t, &nrpc.Error{}, err) {
+		assert.Equal(t, nrpc.Error_CLIENT, err.(*nrpc.Error).Type)
+		assert.Equal(t, "invalid client stream: 2 messages sent, 1 received", err.(*nrpc.Error).Message)
+	}
+
+	// Any other error ends the stream before reaching the flow
+	stream, err = NewClientStream(context.Background(), nc, "test.EchoService.Join", "protobuf", time.Second)
+	assert.Nil(t, err, "NewClientStream error")
+	assert.Nil(t, stream.Send(&wrapperspb.StringValue{Value: "a"}))
+	data, err := nrpc.MarshalErrorResponse("protobuf", &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "canceled"})
+	assert.Nil(t, err)
+	assert.Nil(t, nc.PublishRequest(stream.subject, stream.reply, data))
+	err = stream.CloseAndRecv(&wrapperspb.StringValue{})
+	if assert.IsType(t, &nrpc.Error{}, err) {
+		assert.Equal(t, nrpc.Error_CLIENT, err.(*nrpc.Error).Type)
+		assert.Equal(t, "client stream aborted: canceled", err.(*nrpc.Error).Message)
+	}
+	assert.Len(t, streamIDs, 0, "Aborted streams reach no flow")
+}
+
+func (suite *ServiceTestSuite) TestServeBidiStream() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	// Each request is answered with its value and sequence, "push" through the reply stream
+	trg := startTestProtoTrigger(t, map[string]interface{}{},
+		&testTriggerHandler{
+			settings: map[string]interface{}{"serviceName": "EchoService", "methodName": "Chat"},
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				out := triggerData.(*Output)
+				value := fmt.Sprintf("%s:%v", out.ProtobufRequestMap["value"], out.NrpcData["streamSeq"])
+				if out.ProtobufRequestMap["value"] == "push" {
+					err := out.NrpcData["replyStream"].(*ReplyStream).Send(map[string]interface{}{"value": value})
+					return nil, err
+				}
+				return map[string]interface{}{"data": map[string]interface{}{"value": value}}, nil
+			},
+		},
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	stream, err := NewClientStream(context.Background(), nc, "test.EchoService.Chat", "protobuf", time.Second)
+	assert.Nil(t, err, "NewClientStream error")
+	defer stream.Close()
+
+	for _, value := range []string{"a", "push", "b"} {
+		assert.Nil(t, stream.Send(&wrapperspb.StringValue{Value: value}), "Send error")
+
+		resp := &wrapperspb.StringValue{}
+		assert.Nil(t, stream.Recv(resp), "Recv error")
+		assert.Equal(t, map[string]string{"a": "a:1", "push": "push:2", "b": "b:3"}[value], resp.Value)
+	}
+
+	assert.Nil(t, stream.CloseSend(), "CloseSend error")
+	assert.Equal(t, io.EOF, stream.Recv(&wrapperspb.StringValue{}))
+	assert.Equal(t, errClientStreamClosed, stream.Send(&wrapperspb.StringValue{Value: "late"}))
+}
+
+func TestServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ServiceTestSuite))
+}
@@ -0,0 +1,397 @@
+package nrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	nrpc "github.com/nats-rpc/nrpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// callStreamTTL is how long the reply subject of a completed client stream is remembered, the
+// messages still arriving on it are dropped instead of starting a new call
+const callStreamTTL = time.Minute
+
+// StreamSubjectHeader is the NATS header of the keepalive sent to the client of a client stream
+// once the first request message of the call is received. It carries the subject of the trigger
+// instance serving the call, the following request messages are published to it so that they
+// reach this instance whatever the queue group.
+const StreamSubjectHeader = "Nrpc-Stream-Subject"
+
+// errReplyStreamClosed is returned when sending to the reply stream of a completed call
+var errReplyStreamClosed = errors.New("nRPC reply stream closed")
+
+// ReplyStream sends the replies of a server-streaming nRPC call as the flow produces them. The flow
+// finds it in its nrpcData output under replyStream. Once the flow completes, the items of an array
+// reply data, or the reply data itself, are sent before the end of stream.
+type ReplyStream struct {
+	service *ServiceInfo
+	method  *Method
+	request *nrpc.Request
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// Send converts data into a reply message of the method and sends it to the nRPC client. An error
+// is returned when data is not a valid reply, when the client canceled the call or once the call
+// is complete.
+func (s *ReplyStream) Send(data interface{}) error {
+	msg, err := toReplyMessage(s.service, s.method, data)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return errReplyStreamClosed
+	}
+	if err := s.request.StreamContext.Err(); err != nil {
+		return err
+	}
+	s.request.SendStreamReply(msg)
+	return nil
+}
+
+// close stops sending replies, so that none follows the end of stream
+func (s *ReplyStream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+}
+
+// startStreamedReply switches the request to the nrpc streamed reply protocol, the client
+// heartbeats are checked until the reply is sent and the stream context is canceled when
+// the client is gone
+func startStreamedReply(request *nrpc.Request) {
+	request.EnableStreamedReply()
+	request.StreamContext, request.StreamCancel = context.WithCancel(request.Context)
+	request.KeepStreamAlive = nrpc.NewKeepStreamAlive(
+		request.Conn, request.ReplySubject, request.Encoding, request.StreamCancel)
+}
+
+// dispatchStream dispatches a server-streaming call to the trigger handlers. The replies are sent
+// as the flow produces them and from the flow reply data once it completes, the end of stream is
+// sent by the caller when no error is returned.
+func (t *Trigger) dispatchStream(ctx context.Context, service *ServiceInfo, method *Method, subject string, req proto.Message, request *nrpc.Request) error {
+	stream := &ReplyStream{service: service, method: method, request: request}
+	defer stream.close()
+
+	reply, err := t.Dispatch(ctx, map[string]interface{}{
+		"serviceName": service.ServiceName,
+		"methodName":  method.Name,
+		"subject":     subject,
+		"reqData":     req,
+		"replyStream": stream,
+	})
+	if err != nil {
+		return toNrpcError(err)
+	}
+
+	for _, item := range replyItems(reply.Data) {
+		if err := stream.Send(item); err != nil {
+			return toNrpcError(err)
+		}
+	}
+	return nil
+}
+
+// replyItems returns the items of an array reply data, or the reply data as a single item
+func replyItems(data interface{}) []interface{} {
+	if data == nil {
+		return nil
+	}
+
+	value := reflect.ValueOf(data)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return []interface{}{data}
+	}
+
+	items := make([]interface{}, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items
+}
+
+// callStreams are the client streams of the calls served on a subscription, by reply subject.
+// The request messages following the first one of a call are received on subject.
+type callStreams struct {
+	subject string
+	streams map[string]*callStream
+	mutex   sync.Mutex
+}
+
+// callStream is the stream of request messages of a client-streaming or bidirectional call, the
+// client publishes them with the same reply subject and ends the stream with an nRPC EOS error
+type callStream struct {
+	id      string
+	request *nrpc.Request
+	cancel  context.CancelFunc // Cancels the context of the request
+	msgs    chan *nats.Msg
+	failed  chan *nrpc.Error
+	done    bool
+}
+
+func newCallStreams() *callStreams {
+	return &callStreams{streams: make(map[string]*callStream)}
+}
+
+// open returns the stream of the reply subject of request, created is true for a new stream.
+// Completed streams are returned until callStreamTTL expires.
+func (c *callStreams) open(request *nrpc.Request, cancel context.CancelFunc, queueSize int) (stream *callStream, created bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if stream, ok := c.streams[request.ReplySubject]; ok {
+		return stream, false
+	}
+
+	stream = &callStream{
+		id:      nuid.Next(),
+		request: request,
+		cancel:  cancel,
+		msgs:    make(chan *nats.Msg, queueSize),
+		failed:  make(chan *nrpc.Error, 1),
+	}
+	c.streams[request.ReplySubject] = stream
+	return stream, true
+}
+
+// get returns the stream of the reply subject, nil when unknown
+func (c *callStreams) get(replySubject string) *callStream {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.streams[replySubject]
+}
+
+// isDone reports whether the call of the stream completed
+func (c *callStreams) isDone(stream *callStream) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return stream.done
+}
+
+// complete marks the call of the stream as completed and forgets it after callStreamTTL
+func (c *callStreams) complete(stream *callStream) {
+	c.mutex.Lock()
+	stream.done = true
+	c.mutex.Unlock()
+
+	time.AfterFunc(callStreamTTL, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		delete(c.streams, stream.request.ReplySubject)
+	})
+}
+
+// fail ends the call of the stream with err, unless it already failed
+func (s *callStream) fail(err *nrpc.Error) {
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+// serveStreamMsg queues a request message of a client stream, the call is served in its own
+// goroutine from the first message of the stream. cancel cancels the context of request, the
+// context of the first message is the context of the call.
+func (t *Trigger) serveStreamMsg(h *Handler, streams *callStreams, service *ServiceInfo, method *Method, request *nrpc.Request, cancel context.CancelFunc, msg *nats.Msg) {
+	if msg.Reply == "" {
+		t.logger.Warnf("Dropping nRPC stream message on subject [%s] without reply subject", msg.Subject)
+		cancel()
+		return
+	}
+
+	// Durable requests are served one message at a time
+	if h.triggerSettings.EnableStreaming {
+		defer cancel()
+		t.serveMsg(service, method, request, &nrpc.Error{
+			Type:    nrpc.Error_CLIENT,
+			Message: "client streaming is not supported by durable requests",
+		}, nil)
+		return
+	}
+
+	stream, created := streams.open(request, cancel, h.triggerSettings.workerQueueSize())
+	if !created {
+		cancel()
+	}
+	if !created && streams.isDone(stream) {
+		t.logger.Debugf("Dropping nRPC stream message on subject [%s] received after the end of the call", msg.Subject)
+		return
+	}
+
+	t.queueStreamMsg(stream, msg)
+
+	if created {
+		t.sendStreamSubject(streams, request)
+		h.serveAsync(func() {
+			t.serveCallStream(h, streams, service, method, stream)
+		})
+	}
+}
+
+// serveStreamSubjectMsg queues a request message received on the stream subject of the instance,
+// following the first message of its call
+func (t *Trigger) serveStreamSubjectMsg(streams *callStreams, msg *nats.Msg) {
+	stream := streams.get(msg.Reply)
+	if stream == nil || streams.isDone(stream) {
+		t.logger.Debugf("Dropping nRPC stream message with reply subject [%s] of no running call", msg.Reply)
+		return
+	}
+	t.queueStreamMsg(stream, msg)
+}
+
+// queueStreamMsg queues a request message of the call of the stream, the call fails when the
+// queue is full
+func (t *Trigger) queueStreamMsg(stream *callStream, msg *nats.Msg) {
+	select {
+	case stream.msgs <- msg:
+	default:
+		t.logger.Warnf("Stream queue is full, rejecting nRPC stream [%s] on subject [%s]", stream.id, stream.request.Subject)
+		stream.fail(&nrpc.Error{
+			Type:    nrpc.Error_SERVERTOOBUSY,
+			Message: "server busy: too many pending stream messages",
+		})
+	}
+}
+
+// sendStreamSubject sends the stream subject of the instance to the client of the call with a
+// keepalive, nothing is sent when the NATS server does not support headers
+func (t *Trigger) sendStreamSubject(streams *callStreams, request *nrpc.Request) {
+	nc, ok := request.Conn.(*nats.Conn)
+	if streams.subject == "" || !ok {
+		return
+	}
+
+	msg := nats.NewMsg(request.ReplySubject)
+	msg.Data = []byte{0}
+	msg.Header.Set(StreamSubjectHeader, streams.subject)
+	if err := nc.PublishMsg(msg); err != nil && err != nats.ErrHeadersNotSupported {
+		t.logger.Warnf("Sending the stream subject of nRPC call on subject [%s] failed: %v", request.Subject, err)
+	}
+}
+
+// serveCallStream serves the call of a client stream and replies to it with the nrpc streamed
+// reply protocol, client-streaming methods reply with a single message before the end of stream
+func (t *Trigger) serveCallStream(h *Handler, streams *callStreams, service *ServiceInfo, method *Method, stream *callStream) {
+	defer streams.complete(stream)
+	defer stream.cancel()
+
+	request := stream.request
+	startStreamedReply(request)
+	defer request.StreamCancel()
+
+	request.Handler = func(ctx context.Context) (proto.Message, error) {
+		return nil, t.dispatchCallStream(ctx, h, service, method, stream)
+	}
+	_, replyErr := request.Run()
+	if replyErr != nil {
+		t.logger.Warnf("nRPC stream [%s] on subject [%s] failed: %v", stream.id, request.Subject, replyErr.Message)
+	}
+
+	if err := request.SendReply(nil, replyErr); err != nil {
+		t.logger.Errorf("Reply to nRPC call on subject [%s] failed: %v", request.Subject, err)
+	}
+}
+
+// dispatchCallStream reads the request messages of the stream until the client ends it. The
+// messages of a client-streaming call are dispatched together to the trigger handlers under
+// reqData.messages at the end of the stream, those of a bidirectional call are dispatched one at
+// a time with their streamSeq, the replies are sent as for a server-streaming call. The end of
+// stream is sent by the caller when no error is returned.
+func (t *Trigger) dispatchCallStream(ctx context.Context, h *Handler, service *ServiceInfo, method *Method, stream *callStream) error {
+	replies := &ReplyStream{service: service, method: method, request: stream.request}
+	defer replies.close()
+
+	var (
+		count    uint32
+		messages []proto.Message
+	)
+	for {
+		var msg *nats.Msg
+		select {
+		case msg = <-stream.msgs:
+		case err := <-stream.failed:
+			return err
+		case <-h.closingChannel:
+			// No message is received on the drained subscription anymore
+			return newUnavailableError()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		req := method.NewRequest()
+		err := nrpc.UnmarshalResponse(stream.request.Encoding, msg.Data, req)
+		if nrpcErr, ok := err.(*nrpc.Error); ok {
+			if nrpcErr.Type != nrpc.Error_EOS {
+				return &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "client stream aborted: " + nrpcErr.Message}
+			}
+			if nrpcErr.MsgCount != count {
+				return &nrpc.Error{
+					Type:    nrpc.Error_CLIENT,
+					Message: fmt.Sprintf("invalid client stream: %d messages sent, %d received", nrpcErr.MsgCount, count),
+				}
+			}
+			break
+		}
+		if err != nil {
+			return &nrpc.Error{Type: nrpc.Error_CLIENT, Message: "bad request received: " + err.Error()}
+		}
+		count++
+
+		if !method.ServerStream {
+			messages = append(messages, req)
+			continue
+		}
+
+		reply, err := t.Dispatch(ctx, map[string]interface{}{
+			"serviceName": service.ServiceName,
+			"methodName":  method.Name,
+			"subject":     stream.request.Subject,
+			"streamId":    stream.id,
+			"streamSeq":   count,
+			"reqData":     req,
+			"replyStream": replies,
+		})
+		if err != nil {
+			return toNrpcError(err)
+		}
+		for _, item := range replyItems(reply.Data) {
+			if err := replies.Send(item); err != nil {
+				return toNrpcError(err)
+			}
+		}
+	}
+
+	if method.ServerStream {
+		return nil
+	}
+
+	reply, err := t.Dispatch(ctx, map[string]interface{}{
+		"serviceName": service.ServiceName,
+		"methodName":  method.Name,
+		"subject":     stream.request.Subject,
+		"streamId":    stream.id,
+		"reqData":     map[string]interface{}{"messages": messages},
+	})
+	if err != nil {
+		return toNrpcError(err)
+	}
+	if err := replies.Send(reply.Data); err != nil {
+		return toNrpcError(err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package nrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// tlsVersions maps the tlsMinVersion setting values to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsEnabled reports whether any TLS setting is defined
+func tlsEnabled(settings *Settings) bool {
+	return settings.CaFile != "" ||
+		settings.CertFile != "" ||
+		settings.KeyFile != "" ||
+		settings.SkipVerify ||
+		settings.TLSUseSystemRoots ||
+		settings.TLSMinVersion != "" ||
+		settings.TLSCipherSuites != "" ||
+		settings.TLSServerName != ""
+}
+
+// getTLSConfig builds the TLS client configuration from the trigger settings, it returns nil
+// when no TLS setting is defined
+func getTLSConfig(settings *Settings) (*tls.Config, error) {
+	var err error
+
+	if !tlsEnabled(settings) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         settings.TLSServerName,
+		InsecureSkipVerify: settings.SkipVerify,
+	}
+
+	// Server verification
+	tlsConfig.RootCAs, err = getTLSRootCAs(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Client certificate
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		if settings.CertFile == "" {
+			return nil, fmt.Errorf("Missing certFile setting, required when keyFile is defined")
+		}
+		if settings.KeyFile == "" {
+			return nil, fmt.Errorf("Missing keyFile setting, required when certFile is defined")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid certFile or keyFile setting: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Min TLS version
+	if settings.TLSMinVersion != "" {
+		version, ok := tlsVersions[settings.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("Invalid tlsMinVersion setting [%s], expecting one of 1.0, 1.1, 1.2 or 1.3", settings.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	// Cipher suites
+	if settings.TLSCipherSuites != "" {
+		tlsConfig.CipherSuites, err = getTLSCipherSuites(settings.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// getTLSRootCAs returns the pool of root CAs verifying the server certificate, nil means the
+// system roots are used
+func getTLSRootCAs(settings *Settings) (*x509.CertPool, error) {
+	var err error
+
+	if settings.CaFile == "" {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+	if settings.TLSUseSystemRoots {
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load system roots required by tlsUseSystemRoots setting: %v", err)
+		}
+	}
+
+	caBytes, err := ioutil.ReadFile(settings.CaFile)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid caFile setting: %v", err)
+	}
+	if !pool.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("Invalid caFile setting: no PEM certificate found in %s", settings.CaFile)
+	}
+
+	return pool, nil
+}
+
+// getTLSCipherSuites parses a comma separated list of cipher suite names
+func getTLSCipherSuites(names string) ([]uint16, error) {
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid tlsCipherSuites setting: unknown or insecure cipher suite [%s]", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
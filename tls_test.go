@@ -0,0 +1,222 @@
+package nrpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	natsserver "github.com/nats-io/nats-server/test"
+)
+
+type TLSTestSuite struct {
+	suite.Suite
+	certDir string
+}
+
+func (suite *TLSTestSuite) SetupTest() {
+	var err error
+
+	suite.certDir, err = ioutil.TempDir("", "flogo-nrpc-tls")
+	suite.Require().Nil(err, "Cannot create cert dir")
+
+	caCert, caKey := writeTestCert(suite.T(), suite.certDir, "ca", nil, nil)
+	writeTestCert(suite.T(), suite.certDir, "server", caCert, caKey)
+	writeTestCert(suite.T(), suite.certDir, "client", caCert, caKey)
+}
+
+func (suite *TLSTestSuite) TearDownTest() {
+	os.RemoveAll(suite.certDir)
+}
+
+func (suite *TLSTestSuite) certFile(name string) string {
+	return filepath.Join(suite.certDir, name+".pem")
+}
+
+func (suite *TLSTestSuite) keyFile(name string) string {
+	return filepath.Join(suite.certDir, name+"-key.pem")
+}
+
+func (suite *TLSTestSuite) TestGetTLSConfigDisabled() {
+	t := suite.T()
+
+	tlsConfig, err := getTLSConfig(&Settings{})
+	assert.Nil(t, err, "getTLSConfig error")
+	assert.Nil(t, tlsConfig, "TLS should be disabled without TLS settings")
+}
+
+func (suite *TLSTestSuite) TestGetTLSConfigServerVerification() {
+	t := suite.T()
+
+	tlsConfig, err := getTLSConfig(&Settings{
+		CaFile:        suite.certFile("ca"),
+		TLSServerName: "nats.local",
+	})
+	assert.Nil(t, err, "getTLSConfig error")
+	assert.NotNil(t, tlsConfig.RootCAs, "CA should be loaded")
+	assert.Empty(t, tlsConfig.Certificates, "No client certificate expected")
+	assert.Equal(t, "nats.local", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+}
+
+func (suite *TLSTestSuite) TestGetTLSConfigMutualTLS() {
+	t := suite.T()
+
+	tlsConfig, err := getTLSConfig(&Settings{
+		CaFile:          suite.certFile("ca"),
+		CertFile:        suite.certFile("client"),
+		KeyFile:         suite.keyFile("client"),
+		TLSMinVersion:   "1.3",
+		TLSCipherSuites: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	})
+	assert.Nil(t, err, "getTLSConfig error")
+	assert.Len(t, tlsConfig.Certificates, 1, "Client certificate should be loaded")
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, tlsConfig.CipherSuites)
+}
+
+func (suite *TLSTestSuite) TestGetTLSConfigSkipVerify() {
+	t := suite.T()
+
+	tlsConfig, err := getTLSConfig(&Settings{SkipVerify: true})
+	assert.Nil(t, err, "getTLSConfig error")
+	assert.True(t, tlsConfig.InsecureSkipVerify, "skipVerify should be honored without certificates")
+	assert.Nil(t, tlsConfig.RootCAs, "System roots expected")
+}
+
+func (suite *TLSTestSuite) TestGetTLSConfigValidation() {
+	t := suite.T()
+
+	_, err := getTLSConfig(&Settings{CertFile: suite.certFile("client")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "keyFile")
+
+	_, err = getTLSConfig(&Settings{KeyFile: suite.keyFile("client")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "certFile")
+
+	_, err = getTLSConfig(&Settings{CertFile: suite.certFile("client"), KeyFile: suite.keyFile("server")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "certFile or keyFile")
+
+	_, err = getTLSConfig(&Settings{CaFile: filepath.Join(suite.certDir, "missing.pem")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "caFile")
+
+	_, err = getTLSConfig(&Settings{CaFile: suite.keyFile("ca")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "caFile")
+
+	_, err = getTLSConfig(&Settings{TLSMinVersion: "1.4"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tlsMinVersion")
+
+	_, err = getTLSConfig(&Settings{TLSCipherSuites: "TLS_RSA_WITH_RC4_128_SHA"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "tlsCipherSuites")
+}
+
+func (suite *TLSTestSuite) TestNatsConnectionMutualTLS() {
+	t := suite.T()
+
+	serverCert, err := tls.LoadX509KeyPair(suite.certFile("server"), suite.keyFile("server"))
+	assert.Nil(t, err, "Cannot load server certificate")
+	caBytes, err := ioutil.ReadFile(suite.certFile("ca"))
+	assert.Nil(t, err, "Cannot load CA certificate")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(caBytes)
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = 4443
+	opts.TLSVerify = true
+	opts.TLSTimeout = 2
+	opts.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	s := natsserver.RunServer(&opts)
+	defer s.Shutdown()
+
+	// Client certificate is required by the server
+	_, err = getNatsConnection(log.RootLogger(), &Settings{
+		NatsClusterUrls: "nats://localhost:4443",
+		CaFile:          suite.certFile("ca"),
+	}, nil)
+	assert.NotNil(t, err, "Connection without client certificate should fail")
+
+	nc, err := getNatsConnection(log.RootLogger(), &Settings{
+		NatsClusterUrls: "nats://localhost:4443",
+		CaFile:          suite.certFile("ca"),
+		CertFile:        suite.certFile("client"),
+		KeyFile:         suite.keyFile("client"),
+	}, nil)
+	assert.Nil(t, err, "mTLS connection error")
+	if nc != nil {
+		assert.True(t, nc.IsConnected())
+		nc.Close()
+	}
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(TLSTestSuite))
+}
+
+// writeTestCert writes <name>.pem and <name>-key.pem in dir, the certificate is self-signed
+// when parent is nil
+func writeTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "Cannot generate key")
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.Nil(t, err, "Cannot generate serial number")
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost", "nats.local"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err, "Cannot create certificate")
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err, "Cannot parse certificate")
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err, "Cannot marshal key")
+
+	err = ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.Nil(t, err, "Cannot write certificate")
+	err = ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	assert.Nil(t, err, "Cannot write key")
+
+	return cert, key
+}
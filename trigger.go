@@ -2,14 +2,14 @@ package nrpc
 
 import (
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/project-flogo/core/data"
+	"github.com/project-flogo/core/data/coerce"
 	"github.com/project-flogo/core/data/mapper"
 	"github.com/project-flogo/core/data/metadata"
 	"github.com/project-flogo/core/data/property"
@@ -18,9 +18,10 @@ import (
 	"github.com/project-flogo/core/trigger"
 
 	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
 )
 
-var triggerMd = trigger.NewMetadata(&Settings{}, &Output{})
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{}, &Reply{})
 var resolver = resolve.NewCompositeResolver(map[string]resolve.Resolver{
 	".":        &resolve.ScopeResolver{},
 	"env":      &resolve.EnvResolver{},
@@ -36,10 +37,16 @@ type Factory struct {
 }
 
 type Trigger struct {
-	settings *Settings
-	id       string
-	natsHandlers []*Handler
-	logger log.Logger
+	settings        *Settings
+	id              string
+	natsConns       []*nats.Conn
+	natsHandlers    []*Handler
+	router          *router
+	credentials     *credentialReloader
+	deliveries      *deliveryTracker
+	dynamicServices []ServerService // Services of the protos loaded at Initialize in dynamic mode
+	logger          log.Logger
+	handlersRunning sync.WaitGroup
 }
 
 func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
@@ -49,10 +56,21 @@ func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
 		return nil, err
 	}
 
+	// The protos list items are coerced before the settings are mapped to their struct
+	if protos, ok := sMap["protos"]; ok {
+		sMap["protos"], err = toProtoSettings(protos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = metadata.MapToStruct(sMap, s, true)
 	if err != nil {
 		return nil, err
 	}
+	if _, err = s.subjectPrefix(); err != nil {
+		return nil, err
+	}
 
 	return &Trigger{id: config.Id, settings: s}, nil
 }
@@ -67,14 +85,40 @@ func (t *Trigger) Initialize(ctx trigger.InitContext) error {
 
 	t.logger.Debugf("Trigger Settings: %v", t.settings)
 
+	// Durable requests outcomes are shared by the handlers subscribing and the handlers serving them
+	t.deliveries = newDeliveryTracker()
+
+	// The proto is loaded at runtime instead of generated support files
+	if t.settings.DynamicProto {
+		services, err := loadDynamicServices(t.settings)
+		if err != nil {
+			t.logger.Errorf("Proto loading failed: %v", err)
+			return err
+		}
+		t.dynamicServices = services
+		t.logger.Infof("Loaded %d service(s) from proto files", len(services))
+	}
+
 	// Init handlers
 	for _, handler := range ctx.GetHandlers() {
 
+		// Get Handler Settings
+		handlerSettings := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), handlerSettings, true)
+		if err != nil {
+			return err
+		}
+		t.logger.Debugf("Handler Settings: %v", handlerSettings)
+
 		// Create Trigger Handler
 		natsHandler := &Handler{
 			triggerSettings: t.settings,
+			handlerSettings: handlerSettings,
 			logger:          t.logger,
-			stopChannel: make(chan bool),
+			natsMsgChannel:  make(chan *nrpcRequest, t.settings.workerQueueSize()), // Create NATS message queue
+			stopChannel:     make(chan bool),
+			closingChannel:  make(chan bool),
+			deliveries:      t.deliveries,
 			triggerHandler:  handler,
 		}
 
@@ -83,146 +127,560 @@ func (t *Trigger) Initialize(ctx trigger.InitContext) error {
 		t.logger.Debugf("Registered trigger handler successfully")
 	}
 
+	// Route nRPC calls to the handlers
+	t.router = newRouter(t.natsHandlers)
+
 	return nil
 }
 
-
 // Start implements util.Managed.Start
 func (t *Trigger) Start() error {
-	var err error 
+	// The served services are resolved before any connection is opened
+	services, err := t.serverServices()
+	if err != nil {
+		return err
+	}
+
+	err = t.getConnections()
+	if err != nil {
+		return err
+	}
+
+	for i, handler := range t.natsHandlers {
+
+		// Share the trigger connections among handlers
+		handler.natsConn = t.natsConns[i%len(t.natsConns)]
 
+		// Start handler workers before any nRPC subject is subscribed
+		t.handlersRunning.Add(1)
+		go func(h *Handler) {
+			defer t.handlersRunning.Done()
+			h.HandleMessage()
+		}(handler)
+	}
+
+	// Register each serviceName + protoName once, calls are routed to the handlers by the trigger
+	for _, service := range services {
+		info := service.ServiceInfo()
+
+		// Subscriptions are owned by the first handler bound to the service
+		handler := t.router.serviceHandler(info.ServiceName)
+		if handler == nil {
+			if len(t.natsHandlers) == 0 {
+				t.logger.Warnf("No handler configured, Service [%s] not registered", info.ServiceName)
+				continue
+			}
+			handler = t.natsHandlers[0]
+		}
+
+		if err := service.RunRegisterServerService(handler.natsConn, t, handler); err != nil {
+			t.logger.Errorf("Proto [%s] and Service [%s] registration failed: %v", info.ProtoName, info.ServiceName, err)
+			t.abortStart()
+			return err
+		}
+		t.logger.Infof("Registered Proto [%v] and Service [%v]", info.ProtoName, info.ServiceName)
+	}
+	return nil
+}
+
+// abortStart stops the handler workers and closes the connections of a failed Start
+func (t *Trigger) abortStart() {
+	// The services registered before the failure stop competing for the calls of their queue groups
+	for _, handler := range t.natsHandlers {
+		handler.removeSubscriptions()
+		handler.close()
+	}
+	for _, nc := range t.natsConns {
+		nc.Close()
+	}
+	t.natsConns = nil
+
+	t.handlersRunning.Wait()
 	for _, handler := range t.natsHandlers {
+		handler.fetchersRunning.Wait()
+	}
+
+	if t.credentials != nil {
+		t.credentials.stop()
+	}
+}
+
+// serverServices returns the services served by the trigger, loaded from the protos in dynamic mode
+// or registered by the generated support files of the protos
+func (t *Trigger) serverServices() ([]ServerService, error) {
+	if t.settings.DynamicProto {
+		return t.dynamicServices, nil
+	}
+
+	if len(ServiceRegistery.ServerServices) == 0 {
+		t.logger.Error("nRPC server services not registered")
+		return nil, errors.New("nRPC server services not registered")
+	}
+
+	protos := t.settings.protos()
+	if len(protos) == 0 {
+		t.logger.Error("No proto configured")
+		return nil, errors.New("Invalid protoName setting: required to serve the registered services")
+	}
+
+	// Registry keys are sorted so that the services of a proto are always registered in the same order
+	keys := make([]string, 0, len(ServiceRegistery.ServerServices))
+	for k := range ServiceRegistery.ServerServices {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var services []ServerService
+	served := make(map[string]bool, len(protos))
+	for _, proto := range protos {
+		protoName := proto.name()
+		if protoName == "" {
+			return nil, errors.New("Invalid protos setting: protoName required to serve the registered services")
+		}
+		if served[protoName] {
+			continue
+		}
+		served[protoName] = true
+
+		// The registry holds the services of the protos of every trigger of the app
+		registered := false
+		for _, k := range keys {
+			service := ServiceRegistery.ServerServices[k]
+			if service.ServiceInfo().ProtoName == protoName {
+				services = append(services, service)
+				registered = true
+			}
+		}
+		if !registered {
+			t.logger.Errorf("Proto [%s] not registered", protoName)
+			return nil, fmt.Errorf("Proto [%s] not registered", protoName)
+		}
+	}
+	return services, nil
+}
+
+// getConnections opens the NATS connections shared by all handlers of the trigger
+func (t *Trigger) getConnections() error {
+	var err error
+
+	poolSize := t.settings.natsConnPoolSize()
 
-		err = handler.getConnection()
+	// Rotated certificates and credentials are picked up on the next reconnect
+	if interval := t.settings.credentialReloadInterval(); interval > 0 {
+		t.credentials, err = newCredentialReloader(t.logger, t.settings)
 		if err != nil {
 			return err
 		}
-		
-		protoName := t.settings.ProtoName
-		protoName = strings.Split(protoName, ".")[0]
-
-		// Register each serviceName + protoName
-		if len(ServiceRegistery.ServerServices) != 0 {
-			for k, service := range ServiceRegistery.ServerServices {
-				servRegFlag := false
-				if strings.Compare(k, protoName+service.ServiceInfo().ServiceName) == 0 {
-					t.logger.Infof("Registered Proto [%v] and Service [%v]", protoName, service.ServiceInfo().ServiceName)
-					service.RunRegisterServerService(handler.natsConn, t, handler)
-					servRegFlag = true
-				}
-				if !servRegFlag {
-					t.logger.Errorf("Proto [%s] and Service [%s] not registered", protoName, service.ServiceInfo().ServiceName)
-					return fmt.Errorf("Proto [%s] and Service [%s] not registered", protoName, service.ServiceInfo().ServiceName)
-				}
-			}
+		if t.credentials != nil {
+			t.credentials.start(interval)
+		}
+	}
 
-		} else {
-			t.logger.Error("nRPC server services not registered")
-			return errors.New("nRPC server services not registered")
+	t.logger.Infof("Getting %v NATS connection(s)...", poolSize)
+	for i := 0; i < poolSize; i++ {
+		settings := *t.settings
+		if poolSize > 1 && settings.NatsConnName != "" {
+			settings.NatsConnName = fmt.Sprintf("%s-%d", settings.NatsConnName, i)
+		}
+
+		nc, err := getNatsConnection(t.logger, &settings, t.credentials)
+		if err != nil {
+			for _, opened := range t.natsConns {
+				opened.Close()
+			}
+			t.natsConns = nil
+			if t.credentials != nil {
+				t.credentials.stop()
+			}
+			return err
 		}
+		t.natsConns = append(t.natsConns, nc)
 	}
+	t.logger.Infof("Got NATS connection(s)")
 	return nil
 }
 
+// shutdownGrace is how long Stop waits past the shutdown deadline for the unavailable replies to
+// be sent, and the least time left to drain the NATS connections
+const shutdownGrace = 500 * time.Millisecond
+
 // Stop implements util.Managed.Stop
 func (t *Trigger) Stop() error {
+	var stopErr error
+
+	shutdownTimeout := t.settings.shutdownTimeout()
+	deadline := time.Now().Add(shutdownTimeout)
+
+	// Stop receiving new nRPC requests
 	for _, handler := range t.natsHandlers {
-		handler.stopChannel <- true
-		close(handler.natsMsgChannel)
-		close(handler.stopChannel)
-		_ = handler.natsConn.Drain()
-		handler.natsConn.Close()
+		handler.unsubscribe()
+		handler.close()
 	}
-	return nil
+
+	// Let queued and in-flight Flogo flows finish until the shutdown deadline
+	handlersStopped := make(chan bool)
+	go func() {
+		t.handlersRunning.Wait()
+		for _, handler := range t.natsHandlers {
+			handler.fetchersRunning.Wait()
+			handler.requestsRunning.Wait()
+		}
+		close(handlersStopped)
+	}()
+
+	select {
+	case <-handlersStopped:
+		t.logger.Infof("All nRPC requests completed")
+	case <-time.After(shutdownTimeout):
+		t.logger.Warnf("nRPC requests still running after %v, replying unavailable to the remaining requests", shutdownTimeout)
+		for _, handler := range t.natsHandlers {
+			handler.stop()
+		}
+
+		// The unavailable replies are published before the connections are drained
+		select {
+		case <-handlersStopped:
+		case <-time.After(shutdownGrace):
+			t.logger.Warnf("nRPC requests still running after the shutdown grace period")
+		}
+	}
+
+	// Drain and close NATS connections within the same deadline
+	drainTimeout := time.Until(deadline)
+	if drainTimeout < shutdownGrace {
+		drainTimeout = shutdownGrace
+	}
+	drainErrs := make(chan error, len(t.natsConns))
+	for _, nc := range t.natsConns {
+		if nc.IsClosed() {
+			drainErrs <- nil
+			continue
+		}
+		go func(nc *nats.Conn) {
+			drainErrs <- drainConnection(t.logger, nc, drainTimeout)
+		}(nc)
+	}
+	for range t.natsConns {
+		if err := <-drainErrs; err != nil {
+			t.logger.Errorf("NATS connection drain failed: %v", err)
+			if stopErr == nil {
+				stopErr = err
+			}
+		}
+	}
+
+	if t.credentials != nil {
+		t.credentials.stop()
+	}
+
+	t.logger.Infof("Trigger [%s] stopped", t.id)
+	return stopErr
 }
 
 // Handler is a NATS subject handler
 type Handler struct {
-	triggerSettings  *Settings
-	logger           log.Logger
-	natsConn         *nats.Conn
-	natsMsgChannel   chan interface{}
-	natsSubscription *nats.Subscription
-	stopChannel      chan bool
-	triggerHandler   trigger.Handler
+	triggerSettings   *Settings
+	handlerSettings   *HandlerSettings
+	logger            log.Logger
+	natsConn          *nats.Conn
+	natsMsgChannel    chan *nrpcRequest
+	natsSubscriptions []*nats.Subscription
+	stopChannel       chan bool // Closed when the shutdown deadline is reached
+	closingChannel    chan bool // Closed when the handler stops accepting requests
+	deliveries        *deliveryTracker
+	fetchersRunning   sync.WaitGroup
+	requestsRunning   sync.WaitGroup // Calls served in their own goroutine
+	triggerHandler    trigger.Handler
+	closing           bool
+	stopped           bool
+	mutex             sync.RWMutex
 }
 
-func (h *Handler) getConnection() error {
-	var err error
+// nrpcRequest is a single nRPC call waiting for the Flogo handler, it carries
+// its own reply channel so that concurrent calls never receive each other's result
+type nrpcRequest struct {
+	ctx          context.Context
+	data         map[string]interface{}
+	replyChannel chan *nrpcResult
+}
+
+// nrpcResult is the outcome of the Flogo handler for a single nRPC call
+type nrpcResult struct {
+	reply *Reply
+	err   error
+}
+
+// Subscribe subscribes an nRPC subject on the handler connection, the subscription
+// is removed first when the trigger stops. In durable mode the requests are received
+// through a JetStream durable consumer instead.
+func (h *Handler) Subscribe(subject string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	return h.QueueSubscribe(subject, "", cb)
+}
+
+// QueueSubscribe subscribes subject as a member of the queue group, each message is delivered to a
+// single member of the group. The durable consumer is already shared in durable mode. It returns
+// once the NATS server registered the subscription, so that the calls made after Start are served.
+func (h *Handler) QueueSubscribe(subject, queue string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	return h.queueSubscribe(h.natsConn, subject, queue, cb)
+}
+
+// queueSubscribe subscribes subject as a member of the queue group on the nc connection of the
+// trigger pool, the durable consumer is subscribed on the handler connection
+func (h *Handler) queueSubscribe(nc *nats.Conn, subject, queue string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	var (
+		sub *nats.Subscription
+		err error
+	)
+
+	if h.triggerSettings.EnableStreaming {
+		sub, err = h.durableSubscribe(subject, cb)
+	} else {
+		sub, err = nc.QueueSubscribe(subject, queue, cb)
+		if err == nil {
+			err = nc.Flush()
+		}
+		if err != nil && sub != nil {
+			_ = sub.Unsubscribe()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.mutex.Lock()
+	h.natsSubscriptions = append(h.natsSubscriptions, sub)
+	h.mutex.Unlock()
+
+	h.logger.Debugf("Subscribed nRPC subject [%s] in queue group [%s] on NATS connection [%s]", subject, queue, nc.Opts.Name)
+	return sub, nil
+}
+
+// unsubscribe removes the interest of all nRPC subscriptions of the handler, messages
+// already received are still delivered so that their callbacks can reply
+func (h *Handler) unsubscribe() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, sub := range h.natsSubscriptions {
+		if err := sub.Drain(); err != nil {
+			h.logger.Warnf("Unsubscribe nRPC subject [%s] failed: %v", sub.Subject, err)
+		}
+	}
+	h.natsSubscriptions = nil
+}
+
+// removeSubscriptions unsubscribes all nRPC subscriptions of the handler at once, without
+// delivering the messages already received
+func (h *Handler) removeSubscriptions() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, sub := range h.natsSubscriptions {
+		if err := sub.Unsubscribe(); err != nil {
+			h.logger.Warnf("Unsubscribe nRPC subject [%s] failed: %v", sub.Subject, err)
+		}
+	}
+	h.natsSubscriptions = nil
+}
+
+// close stops accepting requests, workers exit once the queued requests are processed
+func (h *Handler) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closing {
+		return
+	}
+	h.closing = true
+	close(h.natsMsgChannel)
+	close(h.closingChannel)
+}
+
+// stop cancels the requests still running at the shutdown deadline, they are replied unavailable
+func (h *Handler) stop() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.stopped {
+		return
+	}
+	h.stopped = true
+	close(h.stopChannel)
+}
+
+// isClosing reports whether the handler stopped accepting requests
+func (h *Handler) isClosing() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.closing
+}
 
-	// Get NATS Connection
-	h.logger.Infof("Getting NATS connection...")
-	nc, err := getNatsConnection(h.logger, h.triggerSettings)
+// enqueue adds the request to the handler queue without blocking
+func (h *Handler) enqueue(req *nrpcRequest) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.closing {
+		return newUnavailableError()
+	}
+
+	select {
+	case h.natsMsgChannel <- req:
+		return nil
+	default:
+		h.logger.Warnf("Handler queue is full, rejecting %v.%v", req.data["serviceName"], req.data["methodName"])
+		return &nrpc.Error{
+			Type:    nrpc.Error_SERVERTOOBUSY,
+			Message: "server busy: too many pending requests",
+		}
+	}
+}
+
+// Dispatch passes the nRPC request data to the Flogo handler and waits for its reply.
+// A SERVERTOOBUSY nRPC error is returned straight away when the handler queue is full
+// or when the trigger is shutting down.
+func (h *Handler) Dispatch(ctx context.Context, nrpcData map[string]interface{}) (*Reply, error) {
+
+	// The flow is canceled once the call is replied, at the call deadline or at the shutdown deadline
+	ctx, cancel := h.flowContext(ctx)
+	defer cancel()
+
+	req := &nrpcRequest{
+		ctx:          ctx,
+		data:         nrpcData,
+		replyChannel: make(chan *nrpcResult, 1), // Buffered, so workers never block on an abandoned call
+	}
+
+	err := h.enqueue(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	select {
+	case result := <-req.replyChannel:
+		return result.reply, result.err
+	case <-h.stopChannel:
+		return nil, newUnavailableError()
+	case <-ctx.Done():
+		h.logger.Warnf("nRPC call %v.%v not completed: %v", nrpcData["serviceName"], nrpcData["methodName"], ctx.Err())
+		return nil, newTimeoutError(ctx.Err())
 	}
-	h.natsConn = nc
-	h.logger.Infof("Got NATS connection")
-	h.natsMsgChannel = make(chan interface{}) // Create NATS message channel
-	return nil
 }
 
+// flowContext returns the context of the flow serving a call, the handler timeout applies when the
+// caller set no deadline
+func (h *Handler) flowContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); !ok && h.handlerSettings != nil && h.handlerSettings.timeout() > 0 {
+		return context.WithTimeout(ctx, h.handlerSettings.timeout())
+	}
+	return context.WithCancel(ctx)
+}
+
+// HandleMessage runs the handler worker pool and returns once every worker is stopped
 func (h *Handler) HandleMessage() {
+	var wg sync.WaitGroup
+
+	for i := 0; i < h.triggerSettings.workerPoolSize(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runWorker()
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runWorker processes queued nRPC requests until the handler queue is closed
+func (h *Handler) runWorker() {
 
-	for {
+	for req := range h.natsMsgChannel {
 
 		select {
 
-		case done := <-h.stopChannel: // Receive message from Stop Channel
+		case <-h.stopChannel: // Shutdown deadline reached, don't start the remaining requests
+			req.replyChannel <- &nrpcResult{err: newUnavailableError()}
 
-			if done {
-				return
-			}
+		case <-req.ctx.Done(): // Deadline reached or call abandoned while queued
+			req.replyChannel <- &nrpcResult{err: newTimeoutError(req.ctx.Err())}
+
+		default:
+			reply, err := h.handleRequest(req)
+			req.replyChannel <- &nrpcResult{reply: reply, err: err}
+		}
+	}
+}
 
-		case nrpcData := <-h.natsMsgChannel: // Receive NATS Msg from NATS message channel
+// handleRequest runs the Flogo handler for a single nRPC request
+func (h *Handler) handleRequest(req *nrpcRequest) (*Reply, error) {
+	var (
+		err     error
+		content map[string]interface{}
+	)
 
-		  nrpcMap := nrpcData.(map[string]interface{})
-			var (
-				err error
-				content map[string]interface{}
-			)
+	// assign req data content to trigger content, request messages are converted to flow data
+	content, err = coerce.ToObject(flowValue(req.data["reqData"]))
+	if err != nil {
+		h.logger.Error("Conversion failed on nrpc request data")
+		return nil, &nrpc.Error{Type: nrpc.Error_SERVER, Message: "invalid request data: " + err.Error()}
+	}
 
-			// assign req data content to trigger content
-			dataBytes, err := json.Marshal(nrpcMap["reqData"])
-			if err != nil {
-				h.natsMsgChannel <- err
-				h.logger.Error("Marshal failed on grpc request data")
-				continue
-			}
+	out := &Output{
+		NrpcData:           req.data,
+		ProtobufRequestMap: content,
+		Metadata:           requestMetadata(req.ctx),
+		Headers:            requestHeaders(req.ctx),
+		Params:             requestParams(req.ctx),
+	}
 
-			err = json.Unmarshal(dataBytes, &content)
-			if err != nil {
-				h.natsMsgChannel <- err
-				h.logger.Error("Unmarshal failed on grpc request data")
-				continue
-			}
+	result, err := h.triggerHandler.Handle(req.ctx, out)
+	if err != nil {
+		h.logger.Errorf("Trigger handler error: %v", err)
+		return nil, flowError(err)
+	}
 
-			out := &Output{
-				NrpcData: nrpcMap,
-				ProtobufRequestMap: content,
-			}
+	r := &Reply{}
+	err = metadata.MapToStruct(result, r, true)
+	if err != nil {
+		h.logger.Errorf("Reply error: %v", err)
+		return nil, &nrpc.Error{Type: nrpc.Error_SERVER, Message: "invalid reply: " + err.Error()}
+	}
 
-			result, err := h.triggerHandler.Handle(context.Background(), out)
-			if err != nil {
-				h.natsMsgChannel <- err
-				h.logger.Errorf("Trigger handler error: %v", err)
-				continue
-			}
-			
-			r := &Reply{}
-			err = metadata.MapToStruct(result, r, true)
-			if err != nil {
-				h.natsMsgChannel <- err
-				h.logger.Errorf("Reply error: %v", err)
-				continue
-			}
+	// Flows reply errors with their reply code, the reply headers are kept
+	if replyErr := r.replyError(); replyErr != nil {
+		return r, replyErr
+	}
 
-			h.natsMsgChannel <- r
-		}
+	return r, nil
+}
+
+// drainConnection drains the NATS connection and waits until it is closed
+func drainConnection(logger log.Logger, nc *nats.Conn, timeout time.Duration) error {
+	closed := make(chan bool)
+	nc.SetClosedHandler(func(_ *nats.Conn) {
+		close(closed)
+	})
+
+	err := nc.Drain()
+	if err != nil {
+		nc.Close()
+		return err
+	}
+
+	select {
+	case <-closed:
+		logger.Infof("NATS connection [%s] drained", nc.Opts.Name)
+		return nil
+	case <-time.After(timeout):
+		nc.Close()
+		return fmt.Errorf("NATS connection drain did not complete within %v", timeout)
 	}
 }
 
-func getNatsConnection(logger log.Logger, settings *Settings) (*nats.Conn, error) {
+// getNatsConnection connects to NATS, the TLS client certificate and the NATS credentials are
+// read from credentials on each (re)connect when it is not nil
+func getNatsConnection(logger log.Logger, settings *Settings, credentials *credentialReloader) (*nats.Conn, error) {
 	var (
 		err           error
 		authOpts      []nats.Option
@@ -238,7 +696,7 @@ func getNatsConnection(logger log.Logger, settings *Settings) (*nats.Conn, error
 
 	urlString = settings.NatsClusterUrls
 
-	authOpts, err = getNatsConnAuthOpts(settings)
+	authOpts, err = getNatsConnAuthOpts(settings, credentials)
 	if err != nil {
 		return nil, err
 	}
@@ -248,13 +706,14 @@ func getNatsConnection(logger log.Logger, settings *Settings) (*nats.Conn, error
 		return nil, err
 	}
 
-	sslConfigOpts, err = getNatsConnSslConfigOpts(settings)
+	sslConfigOpts, err = getNatsConnSslConfigOpts(settings, credentials)
 	if err != nil {
 		return nil, err
 	}
 
 	natsOptions := append(authOpts, reconnectOpts...)
 	natsOptions = append(natsOptions, sslConfigOpts...)
+	natsOptions = append(natsOptions, getNatsConnEventOpts(logger)...)
 
 	// Check ConnName
 	if len(settings.NatsConnName) > 0 {
@@ -266,12 +725,12 @@ func getNatsConnection(logger log.Logger, settings *Settings) (*nats.Conn, error
 }
 
 // getNatsConnAuthOps return slice of nats.Option specific for NATS authentication
-func getNatsConnAuthOpts(settings *Settings) ([]nats.Option, error) {
+func getNatsConnAuthOpts(settings *Settings, credentials *credentialReloader) ([]nats.Option, error) {
 	opts := make([]nats.Option, 0)
 	// Check auth setting
 
 	if settings.NatsUserName != "" { // Check if usename is defined
-	  // check if password is defined
+		// check if password is defined
 		if settings.NatsUserPassword == "" {
 			return nil, fmt.Errorf("Missing password")
 		} else {
@@ -281,17 +740,48 @@ func getNatsConnAuthOpts(settings *Settings) ([]nats.Option, error) {
 	} else if settings.NatsToken != "" { // Check if token is defined
 		opts = append(opts, nats.Token(settings.NatsToken))
 	} else if settings.NatsNkeySeedfile != "" { // Check if nkey seed file is defined
+		if credentials != nil {
+			opts = append(opts, nats.Nkey(credentials.nkeyPublic, credentials.signNkeyNonce))
+			return opts, nil
+		}
 		nkey, err := nats.NkeyOptionFromSeed(settings.NatsNkeySeedfile)
 		if err != nil {
 			return nil, err
 		}
 		opts = append(opts, nkey)
 	} else if settings.NatsCredentialFile != "" { // Check if credential file is defined
+		if credentials != nil {
+			opts = append(opts, nats.UserJWT(credentials.getUserJWT, credentials.signUserNonce))
+			return opts, nil
+		}
 		opts = append(opts, nats.UserCredentials(settings.NatsCredentialFile))
 	}
 	return opts, nil
 }
 
+// getNatsConnEventOpts return slice of nats.Option logging connection events the same way for all handlers
+func getNatsConnEventOpts(logger log.Logger) []nats.Option {
+	return []nats.Option{
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			if err != nil {
+				logger.Warnf("NATS connection [%s] disconnected: %v", nc.Opts.Name, err)
+			} else {
+				logger.Infof("NATS connection [%s] disconnected", nc.Opts.Name)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Infof("NATS connection [%s] reconnected to %s", nc.Opts.Name, nc.ConnectedUrl())
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			if sub != nil {
+				logger.Errorf("NATS connection [%s] error on subject [%s]: %v", nc.Opts.Name, sub.Subject, err)
+			} else {
+				logger.Errorf("NATS connection [%s] error: %v", nc.Opts.Name, err)
+			}
+		}),
+	}
+}
+
 func getNatsConnReconnectOpts(settings *Settings) ([]nats.Option, error) {
 	opts := make([]nats.Option, 0)
 
@@ -299,7 +789,7 @@ func getNatsConnReconnectOpts(settings *Settings) ([]nats.Option, error) {
 	if !settings.AutoReconnect {
 		opts = append(opts, nats.NoReconnect())
 	}
-	
+
 	// Max reconnect attempts
 	if settings.MaxReconnects > 0 {
 		opts = append(opts, nats.MaxReconnects(settings.MaxReconnects))
@@ -326,36 +816,47 @@ func getNatsConnReconnectOpts(settings *Settings) ([]nats.Option, error) {
 	return opts, nil
 }
 
-func getNatsConnSslConfigOpts(settings *Settings) ([]nats.Option, error) {
+// getNatsConnSslConfigOpts return slice of nats.Option specific for NATS TLS connection
+func getNatsConnSslConfigOpts(settings *Settings, credentials *credentialReloader) ([]nats.Option, error) {
 	opts := make([]nats.Option, 0)
 
-	if settings.CertFile != "" && settings.KeyFile != "" {
-		// Skip verify
-		if settings.SkipVerify {
-			opts = append(opts, nats.Secure(&tls.Config{
-				InsecureSkipVerify: settings.SkipVerify,
-			}))
-		}
-		// CA Root
-		if settings.CaFile != "" {
-			opts = append(opts, nats.RootCAs(settings.CaFile))
-			// Cert file
-			if settings.CertFile != "" {
-				if settings.KeyFile != "" {
-					opts = append(opts, nats.ClientCert(settings.CertFile, settings.KeyFile))
-				} else {
-					return nil, fmt.Errorf("Missing keyFile setting")
-				}
-			} else {
-				return nil, fmt.Errorf("Missing certFile setting")
-			}
-		} else {
-			return nil, fmt.Errorf("Missing caFile setting")
+	tlsConfig, err := getTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if credentials != nil && settings.CertFile != "" {
+			tlsConfig.Certificates = nil
+			tlsConfig.GetClientCertificate = credentials.getClientCertificate
 		}
+		opts = append(opts, nats.Secure(tlsConfig))
 	}
 	return opts, nil
 }
 
+// newUnavailableError returns the nRPC error replied to requests which cannot be served while shutting down
+func newUnavailableError() *nrpc.Error {
+	return &nrpc.Error{
+		Type:    nrpc.Error_SERVERTOOBUSY,
+		Message: "unavailable: trigger is shutting down",
+	}
+}
+
+// newTimeoutError returns the error replied when the call deadline is reached, or the call is
+// canceled, before the flow completes
+func newTimeoutError(err error) *nrpc.Error {
+	if err == context.Canceled {
+		return &nrpc.Error{
+			Type:    nrpc.Error_SERVER,
+			Message: "canceled: call abandoned before the flow completed",
+		}
+	}
+	return &nrpc.Error{
+		Type:    nrpc.Error_SERVER,
+		Message: "timeout: call deadline reached before the flow completed",
+	}
+}
+
 func resolveObject(object map[string]interface{}) (map[string]interface{}, error) {
 	var err error
 
@@ -1,8 +1,14 @@
 package nrpc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/project-flogo/core/action"
 	"github.com/project-flogo/core/data/metadata"
@@ -16,6 +22,8 @@ import (
 
 	"github.com/nats-io/gnatsd/server"
 	natsserver "github.com/nats-io/nats-server/test"
+	nats "github.com/nats-io/nats.go"
+	nrpc "github.com/nats-rpc/nrpc"
 )
 
 type TriggerTestSuite struct {
@@ -36,10 +44,8 @@ func (suite *TriggerTestSuite) SetupTest() {
 					"id":"dummy"
 				},
 				"settings": {
-					"port": 50051,
-					"protoName": "echo",
-					"protoFile": "../../gohub-core-apis/proto/gohub/echo.proto",
-					"enableTLS": false
+					"serviceName": "EchoService",
+					"methodName": "Echo"
 				}
 			}
 		]
@@ -64,7 +70,7 @@ func (suite *TriggerTestSuite) TestFactoryMetadata() {
 
 	m := f.Metadata()
 	assert.NotNil(t, m, "Factory should return its metadata")
-	
+
 }
 
 func (suite *TriggerTestSuite) TestTriggerInitialize() {
@@ -92,8 +98,30 @@ func (suite *TriggerTestSuite) TestTriggerInitialize() {
 	assert.Nil(t, err, "InitTrigger return error")
 	assert.NotNil(t, trg, "Should return trigger instance")
 
+	natsHandlers := trg.(*Trigger).natsHandlers
+	assert.Len(t, natsHandlers, 1)
+	assert.Equal(t, "EchoService", natsHandlers[0].handlerSettings.ServiceName)
+	assert.Equal(t, "Echo", natsHandlers[0].handlerSettings.MethodName)
+
 }
 
+func (suite *TriggerTestSuite) TestHandlerSettingsMatches() {
+	t := suite.T()
+
+	all := &HandlerSettings{}
+	assert.True(t, all.Matches("UserService", "GetUser", "UserService.GetUser"))
+
+	method := &HandlerSettings{ServiceName: "UserService", MethodName: "GetUser"}
+	assert.True(t, method.Matches("UserService", "GetUser", "UserService.GetUser"))
+	assert.False(t, method.Matches("UserService", "ListUsers", "UserService.ListUsers"))
+	assert.False(t, method.Matches("GroupService", "GetUser", "GroupService.GetUser"))
+
+	filter := &HandlerSettings{SubjectFilter: "acme.*.UserService.>"}
+	assert.True(t, filter.Matches("UserService", "GetUser", "acme.tenant1.UserService.GetUser"))
+	assert.True(t, filter.Matches("UserService", "GetUser", "acme.tenant1.UserService.GetUser.json"))
+	assert.False(t, filter.Matches("UserService", "GetUser", "acme.UserService.GetUser"))
+	assert.False(t, filter.Matches("UserService", "GetUser", "other.tenant1.UserService.GetUser"))
+}
 
 func (suite *TriggerTestSuite) TestGetNatsConnAuthOpts() {
 	t := suite.T()
@@ -106,7 +134,7 @@ func (suite *TriggerTestSuite) TestGetNatsConnAuthOpts() {
 	err = metadata.MapToStruct(config.Settings, s, true)
 	assert.Nil(t, err, "MapToStruct error when converting json to Settings")
 
-	_, err = getNatsConnAuthOpts(s)
+	_, err = getNatsConnAuthOpts(s, nil)
 	assert.Nil(t, err, "getNatsConnAuthOpts error")
 }
 
@@ -121,7 +149,7 @@ func (suite *TriggerTestSuite) TestGetNatsConnReconnectOpts() {
 	err = metadata.MapToStruct(config.Settings, s, true)
 	assert.Nil(t, err, "MapToStruct error when converting json to Settings")
 
-	_, err = getNatsConnAuthOpts(s)
+	_, err = getNatsConnAuthOpts(s, nil)
 	assert.Nil(t, err, "getNatsConnAuthOpts error")
 }
 
@@ -136,11 +164,11 @@ func (suite *TriggerTestSuite) TestGetNatsConnSslConfigOpts() {
 	err = metadata.MapToStruct(config.Settings, s, true)
 	assert.Nil(t, err, "MapToStruct error when converting json to Settings")
 
-	_, err = getNatsConnSslConfigOpts(s)
+	_, err = getNatsConnSslConfigOpts(s, nil)
 	assert.Nil(t, err, "getNatsConnSslConfigOpts error")
 }
 
-func (suite *TriggerTestSuite) TestHandlerGetConnection() {
+func (suite *TriggerTestSuite) TestTriggerGetConnections() {
 	t := suite.T()
 
 	s := RunServerWithOptions()
@@ -149,19 +177,55 @@ func (suite *TriggerTestSuite) TestHandlerGetConnection() {
 	config := &trigger.Config{}
 	err := json.Unmarshal([]byte(suite.testConfig), config)
 	assert.Nil(t, err, "Invalid trigger config")
-	
+
 	triggerSettings := &Settings{}
 	err = metadata.MapToStruct(config.Settings, triggerSettings, true)
 	assert.Nil(t, err, "MapToStruct error when converting json to Settings")
 
-	h := &Handler{
-		logger: log.RootLogger(),
-		triggerSettings: triggerSettings,
+	trg := &Trigger{
+		logger:   log.RootLogger(),
+		settings: triggerSettings,
+	}
+
+	err = trg.getConnections()
+	assert.Nil(t, err, "getConnections error")
+	assert.Len(t, trg.natsConns, 1, "Should share a single NATS connection by default")
+
+	trg.natsConns = nil
+	triggerSettings.NatsConnPoolSize = 2
+	triggerSettings.NatsConnName = "pool"
+	err = trg.getConnections()
+	assert.Nil(t, err, "getConnections error")
+	assert.Len(t, trg.natsConns, 2, "Should open the configured connection pool")
+	assert.Equal(t, "pool-0", trg.natsConns[0].Opts.Name)
+	assert.Equal(t, "pool-1", trg.natsConns[1].Opts.Name)
+
+	for _, nc := range trg.natsConns {
+		nc.Close()
 	}
+}
+
+func (suite *TriggerTestSuite) TestTriggerSharedConnection() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
 
-	err = h.getConnection()
-	assert.Nil(t, err, "getConnection error")
-	assert.NotNil(t, h.natsConn, "Cannot get NATS connection")
+	trg := startTestTrigger(t, map[string]interface{}{},
+		newEchoTriggerHandler(map[string]interface{}{"methodName": "GetUser"}, "flowA"),
+		newEchoTriggerHandler(map[string]interface{}{"methodName": "ListUsers"}, "flowB"),
+		newEchoTriggerHandler(map[string]interface{}{"methodName": "DeleteUser"}, "flowC"),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	natsTrigger := trg.(*Trigger)
+	assert.Len(t, natsTrigger.natsConns, 1)
+	assert.Equal(t, 1, s.NumClients(), "All handlers should share one connection")
+	for _, handler := range natsTrigger.natsHandlers {
+		assert.Equal(t, natsTrigger.natsConns[0], handler.natsConn)
+	}
+	assert.Equal(t, 1, natsTrigger.natsConns[0].NumSubscriptions(), "The service is subscribed once on the shared connection")
 }
 
 func (suite *TriggerTestSuite) TestResolveObject() {
@@ -178,10 +242,392 @@ func (suite *TriggerTestSuite) TestResolveObject() {
 	})
 	assert.NotNil(t, err, "resolveObject error")
 	assert.Equal(t, "failed to resolve Environment Variable: 'TEST', ensure that variable is configured", err.Error())
-} 
+}
 
 func (suite *TriggerTestSuite) TestHandlerHandleMessage() {
-	suite.T().Skip("Pending")
+	t := suite.T()
+
+	h := &Handler{
+		logger:          log.RootLogger(),
+		triggerSettings: &Settings{},
+		natsMsgChannel:  make(chan *nrpcRequest, 50),
+		stopChannel:     make(chan bool),
+		closingChannel:  make(chan bool),
+		triggerHandler: &testTriggerHandler{
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				out := triggerData.(*Output)
+				return map[string]interface{}{
+					"code": 0,
+					"data": out.ProtobufRequestMap,
+				}, nil
+			},
+		},
+	}
+	go h.HandleMessage()
+	defer h.close()
+
+	// Concurrent calls must each receive their own reply
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reply, err := h.Dispatch(context.Background(), map[string]interface{}{
+				"methodName":  "Echo",
+				"serviceName": "EchoService",
+				"reqData":     map[string]interface{}{"id": i},
+			})
+			assert.Nil(t, err, "Dispatch error")
+			assert.Equal(t, i, reply.Data.(map[string]interface{})["id"])
+		}(i)
+	}
+	wg.Wait()
+
+	// Handler errors are returned to the caller as nrpc server errors
+	h.triggerHandler = &testTriggerHandler{
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			return nil, errors.New("flow failed")
+		},
+	}
+	_, err := h.Dispatch(context.Background(), map[string]interface{}{"reqData": map[string]interface{}{}})
+	assert.NotNil(t, err, "Dispatch should return handler error")
+	assert.Equal(t, &nrpc.Error{Type: nrpc.Error_SERVER, Message: "flow failed"}, err)
+}
+
+func (suite *TriggerTestSuite) TestHandlerWorkerPool() {
+	t := suite.T()
+
+	var started int32
+	release := make(chan bool)
+	h := &Handler{
+		logger:          log.RootLogger(),
+		triggerSettings: &Settings{WorkerPoolSize: 2, WorkerQueueSize: 1},
+		natsMsgChannel:  make(chan *nrpcRequest, 1),
+		stopChannel:     make(chan bool),
+		closingChannel:  make(chan bool),
+		triggerHandler: &testTriggerHandler{
+			handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+				atomic.AddInt32(&started, 1)
+				<-release
+				return map[string]interface{}{"code": 0}, nil
+			},
+		},
+	}
+	go h.HandleMessage()
+	defer h.close()
+
+	// Fill both workers and the queue with blocked flows
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.Dispatch(context.Background(), map[string]interface{}{"reqData": map[string]interface{}{}})
+			assert.Nil(t, err, "Dispatch error")
+		}()
+		assert.Eventually(t, func() bool {
+			return int(atomic.LoadInt32(&started))+len(h.natsMsgChannel) == i+1
+		}, time.Second, 10*time.Millisecond, "Request should be accepted")
+	}
+
+	// Next call is rejected without blocking
+	_, err := h.Dispatch(context.Background(), map[string]interface{}{"reqData": map[string]interface{}{}})
+	assert.NotNil(t, err, "Dispatch should fail when queue is full")
+	nrpcErr, ok := err.(*nrpc.Error)
+	assert.True(t, ok, "Dispatch should return an nrpc error")
+	assert.Equal(t, nrpc.Error_SERVERTOOBUSY, nrpcErr.Type)
+
+	close(release)
+	wg.Wait()
+}
+
+func (suite *TriggerTestSuite) TestTriggerStartStop() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestTrigger(t, map[string]interface{}{}, newEchoTriggerHandler(nil, ""))
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	msg, err := nc.Request("EchoService.Echo", []byte(`{"message":"hello"}`), time.Second)
+	assert.Nil(t, err, "Request error")
+	assert.JSONEq(t, `{"message":"hello"}`, string(msg.Data))
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- trg.Stop()
+	}()
+	select {
+	case err = <-stopped:
+		assert.Nil(t, err, "Stop error")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Stop did not return")
+	}
+}
+
+func (suite *TriggerTestSuite) TestTriggerGracefulStop() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	started := make(chan bool, 2)
+	release := make(chan bool)
+	canceled := make(chan error, 1)
+	trg := startTestTrigger(t, map[string]interface{}{"shutdownTimeout": 1}, &testTriggerHandler{
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			out := triggerData.(*Output)
+			started <- true
+			if out.ProtobufRequestMap["message"] == "slow" {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					canceled <- ctx.Err()
+				}
+			} else {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return map[string]interface{}{
+				"code": 0,
+				"data": out.ProtobufRequestMap,
+			}, nil
+		},
+	})
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer close(release)
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	replies := make(chan string, 2)
+	for _, message := range []string{"fast", "slow"} {
+		go func(message string) {
+			msg, err := nc.Request("EchoService.Echo", []byte(`{"message":"`+message+`"}`), 5*time.Second)
+			if err != nil {
+				replies <- err.Error()
+				return
+			}
+			replies <- string(msg.Data)
+		}(message)
+		<-started
+	}
+
+	err = trg.Stop()
+	assert.Nil(t, err, "Stop error")
+
+	// The fast flow completed, the slow one overran the shutdown timeout
+	received := []string{<-replies, <-replies}
+	assert.Contains(t, received, `{"message":"fast"}`)
+	assert.Contains(t, received, newUnavailableError().Error())
+	assert.Equal(t, context.Canceled, <-canceled, "The slow flow is canceled at the shutdown deadline")
+
+	// Subjects are not served anymore
+	_, err = nc.Request("EchoService.Echo", []byte(`{"message":"fast"}`), 200*time.Millisecond)
+	assert.Equal(t, nats.ErrTimeout, err)
+}
+
+func (suite *TriggerTestSuite) TestTriggerRouting() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestTrigger(t, map[string]interface{}{},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "GetUser"}, "flowA"),
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "ListUsers"}, "flowB"),
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "OtherService"}, "flowC"),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	msg, err := nc.Request("EchoService.GetUser", []byte(`{}`), time.Second)
+	assert.Nil(t, err, "Request error")
+	assert.JSONEq(t, `{"flow":"flowA"}`, string(msg.Data))
+
+	msg, err = nc.Request("EchoService.ListUsers", []byte(`{}`), time.Second)
+	assert.Nil(t, err, "Request error")
+	assert.JSONEq(t, `{"flow":"flowB"}`, string(msg.Data))
+
+	msg, err = nc.Request("EchoService.DeleteUser", []byte(`{}`), time.Second)
+	assert.Nil(t, err, "Request error")
+	assert.Equal(t, "CLIENT error: unimplemented method: EchoService.DeleteUser", string(msg.Data))
+}
+
+func (suite *TriggerTestSuite) TestTriggerRoutingFallback() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	trg := startTestTrigger(t, map[string]interface{}{},
+		newEchoTriggerHandler(map[string]interface{}{"fallback": true}, "fallback"),
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService"}, "service"),
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "EchoService", "methodName": "GetUser"}, "method"),
+	)
+	defer delete(ServiceRegistery.ServerServices, "echoEchoService")
+	defer trg.Stop()
+
+	router := trg.(*Trigger).router
+	assert.Equal(t, "method", router.route("EchoService", "GetUser", "EchoService.GetUser").triggerHandler.Name())
+	assert.Equal(t, "service", router.route("EchoService", "ListUsers", "EchoService.ListUsers").triggerHandler.Name())
+	assert.Equal(t, "fallback", router.route("OtherService", "GetUser", "OtherService.GetUser").triggerHandler.Name())
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	msg, err := nc.Request("EchoService.GetUser", []byte(`{}`), time.Second)
+	assert.Nil(t, err, "Request error")
+	assert.JSONEq(t, `{"flow":"method"}`, string(msg.Data))
+}
+
+func (suite *TriggerTestSuite) TestTriggerMultipleProtos() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	// The registry holds the services of the protos of every trigger of the app
+	for _, info := range []*ServiceInfo{
+		{ProtoName: "user", ServiceName: "UserService"},
+		{ProtoName: "order", ServiceName: "OrderService"},
+		{ProtoName: "audit", ServiceName: "AuditService"},
+	} {
+		ServiceRegistery.RegisterServerService(&testServerService{serviceInfo: info})
+		defer delete(ServiceRegistery.ServerServices, info.ProtoName+info.ServiceName)
+	}
+
+	trg := startTestTriggerWithSettings(t, map[string]interface{}{
+		"protoName": "user",
+		"protos":    []interface{}{map[string]interface{}{"protoName": "order.proto"}},
+	},
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "UserService"}, "user"),
+		newEchoTriggerHandler(map[string]interface{}{"serviceName": "OrderService"}, "order"),
+	)
+	defer trg.Stop()
+
+	nc, err := nats.Connect("nats://localhost:4222")
+	assert.Nil(t, err, "Cannot connect to NATS")
+	defer nc.Close()
+
+	for subject, flow := range map[string]string{"UserService.Get": "user", "OrderService.Get": "order"} {
+		msg, err := nc.Request(subject, []byte(`{}`), time.Second)
+		assert.Nil(t, err, "Request error for %s", subject)
+		assert.JSONEq(t, `{"flow":"`+flow+`"}`, string(msg.Data))
+	}
+
+	_, err = nc.Request("AuditService.Get", []byte(`{}`), 100*time.Millisecond)
+	assert.NotNil(t, err, "Services of other protos are not served")
+
+	// Each proto of the trigger must be registered
+	f := trigger.GetFactory(support.GetRef(&Trigger{}))
+	missing, err := f.New(&trigger.Config{
+		Id: "flogo-nrpc-trigger",
+		Settings: map[string]interface{}{
+			"natsClusterUrls": "nats://localhost:4222",
+			"protos":          []interface{}{map[string]interface{}{"protoName": "user"}, map[string]interface{}{"protoFile": "protos/billing.proto"}},
+		},
+	})
+	assert.Nil(t, err, "Cannot create trigger")
+	err = missing.Initialize(&testInitContext{})
+	assert.Nil(t, err, "Initialize error")
+	err = missing.Start()
+	if assert.NotNil(t, err, "Expected a Start error for an unregistered proto") {
+		assert.Equal(t, "Proto [billing] not registered", err.Error())
+	}
+	assert.Empty(t, missing.(*Trigger).natsConns, "No connection is opened for unregistered protos")
+	_ = missing.Stop()
+}
+
+func (suite *TriggerTestSuite) TestTriggerStartFailure() {
+	t := suite.T()
+
+	s := RunServerWithOptions()
+	defer s.Shutdown()
+
+	// The services of the proto are registered in order, the second one fails
+	ServiceRegistery.RegisterServerService(&testServerService{serviceInfo: &ServiceInfo{ProtoName: "broken", ServiceName: "AService"}})
+	ServiceRegistery.RegisterServerService(&failingServerService{testServerService{serviceInfo: &ServiceInfo{ProtoName: "broken", ServiceName: "BService"}}})
+	defer delete(ServiceRegistery.ServerServices, "brokenAService")
+	defer delete(ServiceRegistery.ServerServices, "brokenBService")
+
+	f := trigger.GetFactory(support.GetRef(&Trigger{}))
+	trg, err := f.New(&trigger.Config{
+		Id: "flogo-nrpc-trigger",
+		Settings: map[string]interface{}{
+			"natsClusterUrls":  "nats://localhost:4222",
+			"natsConnPoolSize": 2,
+			"protoName":        "broken",
+		},
+	})
+	assert.Nil(t, err, "Cannot create trigger")
+	err = trg.Initialize(&testInitContext{handlers: []trigger.Handler{newEchoTriggerHandler(map[string]interface{}{}, "")}})
+	assert.Nil(t, err, "Initialize error")
+
+	err = trg.Start()
+	if assert.NotNil(t, err, "Expected a Start error for a failed registration") {
+		assert.Equal(t, "registration failed", err.Error())
+	}
+
+	// The subscriptions of the service registered before the failure are removed, the connections
+	// of the failed Start are closed
+	for _, h := range trg.(*Trigger).natsHandlers {
+		assert.Empty(t, h.natsSubscriptions)
+	}
+	assert.Empty(t, trg.(*Trigger).natsConns)
+	assert.Eventually(t, func() bool { return s.NumClients() == 0 }, time.Second, 10*time.Millisecond, "Connections should be closed")
+	assert.Nil(t, trg.Stop(), "Stop error")
+}
+
+func (suite *TriggerTestSuite) TestProtosSetting() {
+	t := suite.T()
+
+	settings := &Settings{}
+	err := settings.FromMap(map[string]interface{}{
+		"protoName": "user",
+		"protos":    `[{"protoName": "order"}, {"protoFile": "protos/billing.proto"}]`,
+	})
+	assert.Nil(t, err, "FromMap error")
+	assert.Equal(t, []ProtoSettings{{ProtoName: "user"}, {ProtoName: "order"}, {ProtoFile: "protos/billing.proto"}}, settings.protos())
+
+	for _, protos := range []interface{}{"not a list", []interface{}{"not an object"}, []interface{}{map[string]interface{}{}}} {
+		err = (&Settings{}).FromMap(map[string]interface{}{"protos": protos})
+		assert.NotNil(t, err, "Expected an error for protos %v", protos)
+	}
+}
+
+func (suite *TriggerTestSuite) TestSubjectPrefixSetting() {
+	t := suite.T()
+
+	for value, expected := range map[string]string{"": "", "dev": "dev", " dev.alice. ": "dev.alice", ".staging": "staging"} {
+		prefix, err := (&Settings{SubjectPrefix: value}).subjectPrefix()
+		assert.Nil(t, err, "subjectPrefix error for %q", value)
+		assert.Equal(t, expected, prefix)
+	}
+	for _, value := range []string{"dev..alice", "dev.*", "dev.>", "dev alice"} {
+		_, err := (&Settings{SubjectPrefix: value}).subjectPrefix()
+		assert.NotNil(t, err, "Expected an error for %q", value)
+	}
+
+	assert.Equal(t, "dev.root.EchoService", PrefixSubject("dev", "root.EchoService"))
+	assert.Equal(t, "dev", PrefixSubject("dev.", ""))
+	assert.Equal(t, "root.EchoService", PrefixSubject("", "root.EchoService"))
+
+	_, err := trigger.GetFactory(support.GetRef(&Trigger{})).New(&trigger.Config{
+		Id:       "flogo-nrpc-trigger",
+		Settings: map[string]interface{}{"natsClusterUrls": "nats://localhost:4222", "subjectPrefix": "dev.*"},
+	})
+	assert.NotNil(t, err, "Expected an error for an invalid subject prefix")
 }
 
 func TestTriggerTestSuite(t *testing.T) {
@@ -190,4 +636,155 @@ func TestTriggerTestSuite(t *testing.T) {
 
 func RunServerWithOptions() *server.Server {
 	return natsserver.RunServer(&natsserver.DefaultTestOptions)
-}
\ No newline at end of file
+}
+
+// testTriggerHandler is a trigger.Handler calling handle for each message
+type testTriggerHandler struct {
+	name     string
+	settings map[string]interface{}
+	handle   func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error)
+}
+
+// newEchoTriggerHandler returns a handler replying with the request data, or with its name when set
+func newEchoTriggerHandler(settings map[string]interface{}, name string) *testTriggerHandler {
+	return &testTriggerHandler{
+		name:     name,
+		settings: settings,
+		handle: func(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+			out := triggerData.(*Output)
+			data := out.ProtobufRequestMap
+			if name != "" {
+				data = map[string]interface{}{"flow": name}
+			}
+			return map[string]interface{}{
+				"code": 0,
+				"data": data,
+			}, nil
+		},
+	}
+}
+
+func (h *testTriggerHandler) Name() string {
+	return h.name
+}
+
+func (h *testTriggerHandler) Settings() map[string]interface{} {
+	return h.settings
+}
+
+func (h *testTriggerHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *testTriggerHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	return h.handle(ctx, triggerData)
+}
+
+// testInitContext is a trigger.InitContext with preset handlers
+type testInitContext struct {
+	handlers []trigger.Handler
+}
+
+func (ctx *testInitContext) GetHandlers() []trigger.Handler {
+	return ctx.handlers
+}
+
+func (ctx *testInitContext) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+// testServerService is a ServerService serving JSON requests on <ServiceName>.<MethodName>
+type testServerService struct {
+	serviceInfo *ServiceInfo
+}
+
+func (s *testServerService) ServiceInfo() *ServiceInfo {
+	return s.serviceInfo
+}
+
+func (s *testServerService) RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler) error {
+	_, err := h.Subscribe(s.serviceInfo.ServiceName+".*", func(msg *nats.Msg) {
+		var reqData map[string]interface{}
+		_ = json.Unmarshal(msg.Data, &reqData)
+
+		// Generated nRPC handlers serve the request with its nrpc.Request in the context
+		ctx, cancel := requestContext(msg)
+		defer cancel()
+		request := nrpc.NewRequest(ctx, nc, msg.Subject, msg.Reply)
+		ctx = context.WithValue(ctx, nrpc.RequestContextKey, request)
+
+		reply, err := t.Dispatch(ctx, map[string]interface{}{
+			"serviceName": s.serviceInfo.ServiceName,
+			"methodName":  strings.TrimPrefix(msg.Subject, s.serviceInfo.ServiceName+"."),
+			"subject":     msg.Subject,
+			"reqData":     reqData,
+		})
+		if err != nil {
+			_ = nc.Publish(msg.Reply, []byte(err.Error()))
+			return
+		}
+
+		replyBytes, _ := json.Marshal(reply.Data)
+		_ = nc.Publish(msg.Reply, replyBytes)
+	})
+	return err
+}
+
+// failingServerService is a testServerService whose registration fails once its subject is subscribed
+type failingServerService struct {
+	testServerService
+}
+
+func (s *failingServerService) RunRegisterServerService(nc *nats.Conn, t *Trigger, h *Handler) error {
+	if err := s.testServerService.RunRegisterServerService(nc, t, h); err != nil {
+		return err
+	}
+	return errors.New("registration failed")
+}
+
+// startTestTrigger starts a trigger serving testServerService with the given handlers
+func startTestTrigger(t *testing.T, settings map[string]interface{}, handlers ...trigger.Handler) trigger.Trigger {
+	return startTestTriggerService(t, &testServerService{
+		serviceInfo: &ServiceInfo{ProtoName: "echo", ServiceName: "EchoService"},
+	}, settings, handlers...)
+}
+
+// startTestTriggerService starts a trigger serving the echo proto service with the given handlers
+func startTestTriggerService(t *testing.T, service ServerService, settings map[string]interface{}, handlers ...trigger.Handler) trigger.Trigger {
+
+	ServiceRegistery.RegisterServerService(service)
+
+	return startTestTriggerWithSettings(t, settings, handlers...)
+}
+
+// startTestTriggerWithSettings starts a trigger with the given settings and handlers, the services
+// served are the registered ones unless the proto is loaded dynamically
+func startTestTriggerWithSettings(t *testing.T, settings map[string]interface{}, handlers ...trigger.Handler) trigger.Trigger {
+
+	ref := support.GetRef(&Trigger{})
+	f := trigger.GetFactory(ref)
+
+	triggerSettings := map[string]interface{}{
+		"natsClusterUrls": "nats://localhost:4222",
+		"protoName":       "echo",
+	}
+	for k, v := range settings {
+		triggerSettings[k] = v
+	}
+
+	trg, err := f.New(&trigger.Config{
+		Id:       "flogo-nrpc-trigger",
+		Settings: triggerSettings,
+	})
+	assert.Nil(t, err, "Cannot create trigger")
+
+	err = trg.Initialize(&testInitContext{
+		handlers: handlers,
+	})
+	assert.Nil(t, err, "Initialize error")
+
+	err = trg.Start()
+	assert.Nil(t, err, "Start error")
+
+	return trg
+}